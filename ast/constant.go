@@ -0,0 +1,128 @@
+package ast
+
+import (
+	. "compiler/util"
+	"go/constant"
+	"go/token"
+)
+
+// Constant folds an expression and returns its value, or nil if the
+// value is not known at compile time. Integer results are exact, reals
+// are kept as floats and relational and boolean operators produce bools.
+func Constant(expr Expr) constant.Value {
+	switch e := expr.(type) {
+	case *Literal:
+		return e.Value
+	case *Unary:
+		x := Constant(e.X)
+		if x == nil {
+			return nil
+		}
+
+		switch e.Op {
+		case SUB:
+			return constant.UnaryOp(token.SUB, x, 0)
+		case ADD:
+			return x
+		case NOT:
+			return constant.UnaryOp(token.NOT, x, 0)
+		}
+	case *Binary:
+		x := Constant(e.X)
+		y := Constant(e.Y)
+		if x == nil || y == nil {
+			return nil
+		}
+
+		return binaryOp(e.Op, x, y)
+	case *Call:
+		if len(e.Args) != 1 {
+			return nil
+		}
+
+		x := Constant(e.Args[0])
+		if x == nil || x.Kind() != constant.Int {
+			return nil
+		}
+
+		switch e.Name {
+		case "ord":
+			return x
+		case "succ":
+			return constant.BinaryOp(x, token.ADD, constant.MakeInt64(1))
+		case "pred":
+			return constant.BinaryOp(x, token.SUB, constant.MakeInt64(1))
+		}
+	}
+
+	return nil
+}
+
+func binaryOp(op AttributeType, x constant.Value, y constant.Value) constant.Value {
+	switch op {
+	case ADD:
+		return constant.BinaryOp(x, token.ADD, y)
+	case SUB:
+		return constant.BinaryOp(x, token.SUB, y)
+	case MUL:
+		return constant.BinaryOp(x, token.MUL, y)
+	case REAL_DIV:
+		if constant.Sign(y) == 0 {
+			return nil
+		}
+		return constant.BinaryOp(constant.ToFloat(x), token.QUO, constant.ToFloat(y))
+	case DIV:
+		if constant.Sign(y) == 0 {
+			return nil
+		}
+		return constant.BinaryOp(x, token.QUO_ASSIGN, y)
+	case MOD:
+		if constant.Sign(y) == 0 {
+			return nil
+		}
+		return constant.BinaryOp(x, token.REM, y)
+	case AND:
+		return constant.BinaryOp(x, token.LAND, y)
+	case OR:
+		return constant.BinaryOp(x, token.LOR, y)
+	case EQ:
+		return constant.MakeBool(constant.Compare(x, token.EQL, y))
+	case NOT_EQ:
+		return constant.MakeBool(constant.Compare(x, token.NEQ, y))
+	case LESS:
+		return constant.MakeBool(constant.Compare(x, token.LSS, y))
+	case LESS_EQ:
+		return constant.MakeBool(constant.Compare(x, token.LEQ, y))
+	case GREATER:
+		return constant.MakeBool(constant.Compare(x, token.GTR, y))
+	case GREATER_EQ:
+		return constant.MakeBool(constant.Compare(x, token.GEQ, y))
+	}
+
+	return nil
+}
+
+// IntValue returns the value of an integer constant expression. The
+// second result is false if expr is not an integer constant, or is one
+// too large for an int; the parser reports constants that do not fit in
+// an integer where they are folded.
+func IntValue(expr Expr) (int, bool) {
+	value := Constant(expr)
+	if value == nil || value.Kind() != constant.Int {
+		return 0, false
+	}
+
+	n, exact := constant.Int64Val(value)
+	return int(n), exact
+}
+
+// BoolValue returns the value of a boolean constant expression. The
+// second result is false if expr is not a boolean constant.
+func BoolValue(expr Expr) (bool, bool) {
+	value := Constant(expr)
+	if value == nil || value.Kind() != constant.Bool {
+		return false, false
+	}
+
+	return constant.BoolVal(value), true
+}
@@ -0,0 +1,212 @@
+package ast
+
+import (
+	"compiler/types"
+	. "compiler/util"
+	"go/constant"
+)
+
+// Expr is a node in the tree the parser builds for an expression. Every
+// node carries the type the parser assigned to it while checking it.
+type Expr interface {
+	Type() types.Type
+}
+
+// Literal is a number or any other value known at compile time, such as
+// an enumerator.
+type Literal struct {
+	Value constant.Value
+	typ   types.Type
+}
+
+// Ident is a reference to a variable or parameter.
+type Ident struct {
+	Name   string
+	Symbol *Symbol
+	typ    types.Type
+}
+
+// Index selects one element of an array.
+type Index struct {
+	X     Expr
+	Index Expr
+	typ   types.Type
+}
+
+// Selector selects one field of a record.
+type Selector struct {
+	X     Expr
+	Field string
+	typ   types.Type
+}
+
+// Set is a set constructor such as [1, 3..5]. Each element is either a
+// single value or a Range.
+type Set struct {
+	Elems []Expr
+	typ   types.Type
+}
+
+// Range is a range of values low..high inside a set constructor.
+type Range struct {
+	Low  Expr
+	High Expr
+}
+
+// Deref is the variable a pointer points to.
+type Deref struct {
+	X   Expr
+	typ types.Type
+}
+
+// Nil is the nil pointer.
+type Nil struct{}
+
+// Unary is a sign or "not" applied to an operand.
+type Unary struct {
+	Op  AttributeType
+	X   Expr
+	typ types.Type
+}
+
+// Binary is an ADDOP, MULOP or RELOP applied to two operands.
+type Binary struct {
+	Op  AttributeType
+	X   Expr
+	Y   Expr
+	typ types.Type
+}
+
+// Call is a call to a built-in function.
+type Call struct {
+	Name string
+	Args []Expr
+	typ  types.Type
+}
+
+// Bad stands in for an expression that could not be checked.
+type Bad struct{}
+
+// IsVariable reports whether expr denotes a variable, which is what a
+// pointer built-in needs as its argument.
+func IsVariable(expr Expr) bool {
+	switch expr.(type) {
+	case *Ident, *Index, *Selector, *Deref:
+		return true
+	}
+	return false
+}
+
+// Root returns the variable that expr is part of, or nil when expr is
+// not a variable. The second result is true when expr is reached through
+// a pointer, so that assigning to expr leaves the root unchanged.
+func Root(expr Expr) (*Ident, bool) {
+	switch x := expr.(type) {
+	case *Ident:
+		return x, false
+	case *Index:
+		return Root(x.X)
+	case *Selector:
+		return Root(x.X)
+	case *Deref:
+		ident, _ := Root(x.X)
+		return ident, true
+	}
+	return nil, false
+}
+
+func NewLiteral(value constant.Value, typ types.Type) *Literal {
+	return &Literal{value, typ}
+}
+
+func NewIdent(name string, sym *Symbol, typ types.Type) *Ident {
+	return &Ident{name, sym, typ}
+}
+
+func NewIndex(x Expr, index Expr, typ types.Type) *Index {
+	return &Index{x, index, typ}
+}
+
+func NewSelector(x Expr, field string, typ types.Type) *Selector {
+	return &Selector{x, field, typ}
+}
+
+func NewSet(elems []Expr, typ types.Type) *Set {
+	return &Set{elems, typ}
+}
+
+func NewRange(low Expr, high Expr) *Range {
+	return &Range{low, high}
+}
+
+func NewDeref(x Expr, typ types.Type) *Deref {
+	return &Deref{x, typ}
+}
+
+func NewNil() *Nil {
+	return &Nil{}
+}
+
+func NewUnary(op AttributeType, x Expr, typ types.Type) *Unary {
+	return &Unary{op, x, typ}
+}
+
+func NewBinary(op AttributeType, x Expr, y Expr, typ types.Type) *Binary {
+	return &Binary{op, x, y, typ}
+}
+
+func NewCall(name string, args []Expr, typ types.Type) *Call {
+	return &Call{name, args, typ}
+}
+
+func NewBad() *Bad {
+	return &Bad{}
+}
+
+func (lit *Literal) Type() types.Type {
+	return lit.typ
+}
+
+func (ident *Ident) Type() types.Type {
+	return ident.typ
+}
+
+func (index *Index) Type() types.Type {
+	return index.typ
+}
+
+func (sel *Selector) Type() types.Type {
+	return sel.typ
+}
+
+func (set *Set) Type() types.Type {
+	return set.typ
+}
+
+func (r *Range) Type() types.Type {
+	return r.Low.Type()
+}
+
+func (deref *Deref) Type() types.Type {
+	return deref.typ
+}
+
+func (n *Nil) Type() types.Type {
+	return types.Nil
+}
+
+func (unary *Unary) Type() types.Type {
+	return unary.typ
+}
+
+func (binary *Binary) Type() types.Type {
+	return binary.typ
+}
+
+func (call *Call) Type() types.Type {
+	return call.typ
+}
+
+func (bad *Bad) Type() types.Type {
+	return types.Invalid
+}
@@ -0,0 +1,219 @@
+package ast
+
+import (
+	. "compiler/util"
+)
+
+// Stmt is a node in the tree the parser builds for a statement. Line is
+// the source line the statement starts on.
+type Stmt interface {
+	Line() int
+}
+
+// Assign stores Value in the variable X.
+type Assign struct {
+	X     Expr
+	Value Expr
+	line  int
+}
+
+// ProcCall is a procedure call. Proc is nil for a call to a built-in
+// procedure or to a procedure that could not be found.
+type ProcCall struct {
+	Name string
+	Proc *GreenNode
+	Args []Expr
+	line int
+}
+
+// Block is a compound statement, or the statements of a repeat loop or
+// of the else part of a case statement.
+type Block struct {
+	List []Stmt
+	line int
+}
+
+// If is an if statement. Else is nil when there is no else part.
+type If struct {
+	Cond Expr
+	Then Stmt
+	Else Stmt
+	line int
+}
+
+type While struct {
+	Cond Expr
+	Body Stmt
+	line int
+}
+
+// For is a for loop. Down is true for a "downto" loop.
+type For struct {
+	Control Expr
+	Initial Expr
+	Final   Expr
+	Down    bool
+	Body    Stmt
+	line    int
+}
+
+// Repeat runs Body until Cond is true. condLine is the line of the
+// until part, which may be well after the line the loop starts on.
+type Repeat struct {
+	Body     *Block
+	Cond     Expr
+	condLine int
+	line     int
+}
+
+// Case is a case statement. Else is nil when there is no else part.
+type Case struct {
+	Selector Expr
+	Clauses  []*CaseClause
+	Else     *Block
+	line     int
+}
+
+// CaseClause is one case element. Labels holds the low and high value
+// of each label; a single label has low equal to high.
+type CaseClause struct {
+	Labels [][2]int
+	Body   Stmt
+	line   int
+}
+
+// BranchKind is the kind of jump a Branch makes.
+type BranchKind uint
+
+const (
+	Break BranchKind = iota
+	Continue
+	Exit
+)
+
+var BranchStrings map[BranchKind]string = map[BranchKind]string{
+	Break:    "break",
+	Continue: "continue",
+	Exit:     "exit",
+}
+
+// Branch is an explicit jump. Break leaves the innermost enclosing loop,
+// Continue goes on to its next iteration and Exit returns from the
+// procedure or program.
+type Branch struct {
+	Kind BranchKind
+	line int
+}
+
+// BadStmt stands in for a statement that could not be parsed.
+type BadStmt struct {
+	line int
+}
+
+// Body is the statement part of a procedure or program. Scope is the
+// procedure or program it belongs to.
+type Body struct {
+	Scope *GreenNode
+	Block *Block
+}
+
+func NewBody(scope *GreenNode, block *Block) *Body {
+	return &Body{scope, block}
+}
+
+func NewAssign(x Expr, value Expr, line int) *Assign {
+	return &Assign{x, value, line}
+}
+
+func NewProcCall(name string, proc *GreenNode, args []Expr, line int) *ProcCall {
+	return &ProcCall{name, proc, args, line}
+}
+
+func NewBlock(list []Stmt, line int) *Block {
+	return &Block{list, line}
+}
+
+func NewIf(cond Expr, then Stmt, els Stmt, line int) *If {
+	return &If{cond, then, els, line}
+}
+
+func NewWhile(cond Expr, body Stmt, line int) *While {
+	return &While{cond, body, line}
+}
+
+func NewFor(control Expr, initial Expr, final Expr, down bool, body Stmt, line int) *For {
+	return &For{control, initial, final, down, body, line}
+}
+
+func NewRepeat(body *Block, cond Expr, condLine int, line int) *Repeat {
+	return &Repeat{body, cond, condLine, line}
+}
+
+func NewCase(selector Expr, clauses []*CaseClause, els *Block, line int) *Case {
+	return &Case{selector, clauses, els, line}
+}
+
+func NewCaseClause(labels [][2]int, body Stmt, line int) *CaseClause {
+	return &CaseClause{labels, body, line}
+}
+
+func NewBranch(kind BranchKind, line int) *Branch {
+	return &Branch{kind, line}
+}
+
+func NewBadStmt(line int) *BadStmt {
+	return &BadStmt{line}
+}
+
+func (assign *Assign) Line() int {
+	return assign.line
+}
+
+func (call *ProcCall) Line() int {
+	return call.line
+}
+
+func (block *Block) Line() int {
+	return block.line
+}
+
+func (stmt *If) Line() int {
+	return stmt.line
+}
+
+func (stmt *While) Line() int {
+	return stmt.line
+}
+
+func (stmt *For) Line() int {
+	return stmt.line
+}
+
+func (stmt *Repeat) Line() int {
+	return stmt.line
+}
+
+// CondLine returns the line of the until part of the loop.
+func (stmt *Repeat) CondLine() int {
+	return stmt.condLine
+}
+
+func (stmt *Case) Line() int {
+	return stmt.line
+}
+
+func (clause *CaseClause) Line() int {
+	return clause.line
+}
+
+func (branch *Branch) Line() int {
+	return branch.line
+}
+
+func (bad *BadStmt) Line() int {
+	return bad.line
+}
+
+func (kind BranchKind) String() string {
+	return BranchStrings[kind]
+}
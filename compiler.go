@@ -18,26 +18,54 @@ package main
 
 /* Proj 2 */
 import (
+	"flag"
 	"fmt"
 	_ "io"
 	_ "io/ioutil"
 	"os"
 	_ "strconv"
+	"strings"
 	_ "time"
 )
 
 import scan "compiler/scanner"
 import parse "compiler/parser"
-import _ "compiler/util"
+import "compiler/util"
 
 /* End Proj 2 */
 
 func main() {
 	// Get the arguments passed to the compiler
-	args := os.Args
-	file := args[1]
+	dialectName := flag.String("dialect", "legacy", "statement syntax: legacy requires \"call\" for procedure calls, standard does not")
+	xref := flag.Bool("xref", false, "write a cross-reference of every identifier to xref.txt and xref.json")
+	callGraph := flag.Bool("callgraph", false, "write the call graph to callgraph.dot and callgraph.json")
+	scopeGraph := flag.Bool("scopes", false, "write the scope tree with every frame layout to scope_tree.dot")
+	nowarn := flag.String("nowarn", "", "comma separated warnings to suppress: uninitialized, unused, uncalled, dead-assignment, unreachable, constant-condition, index-range, division-by-zero, overflow")
+	flag.Parse()
+
+	dialect, err := parse.ParseDialect(*dialectName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	var suppressed []util.WarningKind
+	if *nowarn != "" {
+		for _, name := range strings.Split(*nowarn, ",") {
+			kind, err := util.ParseWarningKind(strings.TrimSpace(name))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+			suppressed = append(suppressed, kind)
+		}
+	}
+
+	args := flag.Args()
+
+	if len(args) > 0 {
+		file := args[0]
 
-	if len(args) > 1 {
 		scanner := scan.NewScanner()
 		scanner.ReadReservedFile("scanner/reserved_words.list")
 		scanner.ReadSourceFile(file)
@@ -75,6 +103,13 @@ func main() {
 
 		/* Proj 2 */
 		parser := parse.NewParser(scanner)
+		parser.SetDialect(dialect)
+		parser.SetCrossReference(*xref)
+		parser.SetCallGraph(*callGraph)
+		parser.SetScopeGraph(*scopeGraph)
+		for _, kind := range suppressed {
+			parser.SuppressWarning(kind)
+		}
 		parser.Begin(file)
 		/* End Proj 2 */
 	} else {
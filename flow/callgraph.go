@@ -0,0 +1,285 @@
+package flow
+
+import (
+	"bytes"
+	"compiler/ast"
+	. "compiler/util"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CallGraph records which procedures each procedure, and the body of
+// the program or unit, calls. It has a node for every scope in the
+// scope tree, named by its path, and one for each procedure of another
+// unit that is called.
+type CallGraph struct {
+	Root  string
+	Nodes []*CallNode
+	Calls []*CallEdge
+	nodes map[*GreenNode]*CallNode
+}
+
+// CallNode is one procedure, or the program or a unit.
+//
+// A procedure is directly recursive when it calls itself, and mutually
+// recursive when it calls a procedure that leads back to it. A leaf is
+// a procedure that calls no procedures. StackDepth is the largest number of bytes of
+// stack that calls starting at the node can use: the frame of the node
+// plus the deepest chain of frames below it. Chains that enter a
+// recursive procedure are left out, since their depth cannot be known,
+// and Bounded is false when there are any. StackDepth is -1 for a
+// recursive procedure. External procedures belong to another unit;
+// their calls are not known, so only their own frame is counted.
+type CallNode struct {
+	Name              string
+	Kind              string
+	Level             int
+	FrameSize         int
+	DirectlyRecursive bool
+	MutuallyRecursive bool
+	Leaf              bool
+	External          bool
+	StackDepth        int
+	Bounded           bool
+	static            bool
+	callees           []*CallNode
+}
+
+// CallEdge is a call from one procedure to another, with the lines of
+// every call statement that makes it.
+type CallEdge struct {
+	From  string
+	To    string
+	Lines []int
+}
+
+// NewCallGraph builds the call graph of the program or unit with scope
+// tree root from the control-flow graphs of its bodies.
+func NewCallGraph(root *GreenNode, bodies []*ast.Body) *CallGraph {
+	cg := &CallGraph{Root: root.Path(), nodes: make(map[*GreenNode]*CallNode)}
+	for _, frame := range root.Frames() {
+		cg.add(frame)
+	}
+
+	edges := make(map[[2]*CallNode]*CallEdge)
+	for _, body := range bodies {
+		graph := New(body)
+		from := cg.nodes[graph.Body.Scope]
+		for _, block := range graph.Blocks {
+			for _, step := range block.Steps {
+				call, ok := step.Stmt.(*ast.ProcCall)
+				if !ok || call.Proc == nil {
+					continue
+				}
+
+				to := cg.nodes[call.Proc]
+				if to == nil {
+					to = cg.add(NewFrame(call.Proc))
+					to.External = true
+				}
+
+				edge := edges[[2]*CallNode{from, to}]
+				if edge == nil {
+					edge = &CallEdge{From: from.Name, To: to.Name}
+					edges[[2]*CallNode{from, to}] = edge
+					cg.Calls = append(cg.Calls, edge)
+					from.callees = append(from.callees, to)
+				}
+				edge.Lines = append(edge.Lines, step.Line)
+			}
+		}
+	}
+
+	for _, edge := range cg.Calls {
+		sort.Ints(edge.Lines)
+	}
+	sort.SliceStable(cg.Calls, func(i, j int) bool {
+		if cg.Calls[i].From != cg.Calls[j].From {
+			return cg.Calls[i].From < cg.Calls[j].From
+		}
+		return cg.Calls[i].To < cg.Calls[j].To
+	})
+
+	cg.findRecursion()
+	for _, node := range cg.Nodes {
+		node.Leaf = len(node.callees) == 0 && !node.External && !node.static
+	}
+	cg.stackDepths()
+	return cg
+}
+
+func (cg *CallGraph) add(frame *Frame) *CallNode {
+	node := &CallNode{Name: frame.Name, Kind: frame.Kind, Level: frame.Level, static: frame.Static}
+	if !frame.Static {
+		node.FrameSize = frame.Size
+	}
+	cg.nodes[frame.Node()] = node
+	cg.Nodes = append(cg.Nodes, node)
+	return node
+}
+
+// findRecursion flags the procedures that lie on a cycle of calls. The
+// cycles are found as the strongly connected components of the graph,
+// using Tarjan's algorithm.
+func (cg *CallGraph) findRecursion() {
+	index := make(map[*CallNode]int)
+	low := make(map[*CallNode]int)
+	onStack := make(map[*CallNode]bool)
+	var stack []*CallNode
+
+	var visit func(node *CallNode)
+	visit = func(node *CallNode) {
+		index[node] = len(index)
+		low[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, callee := range node.callees {
+			if callee == node {
+				node.DirectlyRecursive = true
+			}
+			if _, seen := index[callee]; !seen {
+				visit(callee)
+				low[node] = min(low[node], low[callee])
+			} else if onStack[callee] {
+				low[node] = min(low[node], index[callee])
+			}
+		}
+
+		if low[node] != index[node] {
+			return
+		}
+		var component []*CallNode
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == node {
+				break
+			}
+		}
+		if len(component) > 1 {
+			for _, member := range component {
+				member.MutuallyRecursive = true
+			}
+		}
+	}
+
+	for _, node := range cg.Nodes {
+		if _, seen := index[node]; !seen {
+			visit(node)
+		}
+	}
+}
+
+// stackDepths computes the stack depth of every node.
+func (cg *CallGraph) stackDepths() {
+	done := make(map[*CallNode]bool)
+
+	var depth func(node *CallNode)
+	depth = func(node *CallNode) {
+		if done[node] {
+			return
+		}
+		done[node] = true
+
+		if node.DirectlyRecursive || node.MutuallyRecursive {
+			node.StackDepth = -1
+			return
+		}
+
+		deepest := 0
+		node.Bounded = true
+		for _, callee := range node.callees {
+			depth(callee)
+			if callee.StackDepth < 0 || !callee.Bounded {
+				node.Bounded = false
+			}
+			deepest = max(deepest, callee.StackDepth)
+		}
+		node.StackDepth = node.FrameSize + deepest
+	}
+
+	for _, node := range cg.Nodes {
+		depth(node)
+	}
+}
+
+// Flags describes how node takes part in recursion, or that it is a
+// leaf, in words.
+func (node *CallNode) Flags() string {
+	var flags []string
+	if node.DirectlyRecursive {
+		flags = append(flags, "directly recursive")
+	}
+	if node.MutuallyRecursive {
+		flags = append(flags, "mutually recursive")
+	}
+	if node.Leaf {
+		flags = append(flags, "leaf")
+	}
+	if node.External {
+		flags = append(flags, "external")
+	}
+	return strings.Join(flags, ", ")
+}
+
+// Dot returns the call graph in the Graphviz DOT language. Recursive
+// procedures are drawn in red and leaves with a dashed border.
+func (cg *CallGraph) Dot() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "digraph %s {\n", strconv.Quote(cg.Root))
+	buf.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	for _, node := range cg.Nodes {
+		label := node.Name + "\\n" + node.Kind
+		if node.FrameSize > 0 {
+			label += "\\nframe " + strconv.Itoa(node.FrameSize)
+		}
+		switch {
+		case node.StackDepth < 0:
+			label += "\\nstack unbounded"
+		case node.Bounded:
+			label += "\\nstack " + strconv.Itoa(node.StackDepth)
+		default:
+			label += "\\nstack " + strconv.Itoa(node.StackDepth) + " + recursion"
+		}
+		if flags := node.Flags(); flags != "" {
+			label += "\\n" + flags
+		}
+
+		attrs := "label=\"" + label + "\""
+		switch {
+		case node.DirectlyRecursive || node.MutuallyRecursive:
+			attrs += ", color=red"
+		case node.External:
+			attrs += ", style=dotted"
+		case node.Leaf:
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&buf, "\t%s [%s];\n", strconv.Quote(node.Name), attrs)
+	}
+
+	for _, edge := range cg.Calls {
+		fmt.Fprintf(&buf, "\t%s -> %s [label=\"%s\"];\n", strconv.Quote(edge.From), strconv.Quote(edge.To), LineList(edge.Lines))
+	}
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// Write writes the call graph in DOT to callgraph.dot and as JSON to
+// callgraph.json.
+func (cg *CallGraph) Write() {
+	ioutil.WriteFile("callgraph.dot", []byte(cg.Dot()), 0644)
+
+	data, err := json.MarshalIndent(cg, "", "\t")
+	if err == nil {
+		ioutil.WriteFile("callgraph.json", data, 0644)
+	}
+}
@@ -0,0 +1,390 @@
+package flow
+
+import (
+	"compiler/ast"
+	"compiler/types"
+	. "compiler/util"
+	"go/constant"
+)
+
+// Graph is the control-flow graph of the body of a procedure or of the
+// program. Entry is where the body starts and Exit is reached when it
+// returns, either by running off its end or through exit.
+type Graph struct {
+	Body   *ast.Body
+	Entry  *Block
+	Exit   *Block
+	Blocks []*Block
+}
+
+// Block is a basic block: steps that run one after the other, followed
+// by a jump to one of Succs. A block that ends by testing Cond jumps to
+// True when it holds and to False when it does not; only one of them is
+// a successor when Cond is constant.
+type Block struct {
+	Index int
+	Steps []*Step
+	Succs []*Block
+	Preds []*Block
+	Cond  ast.Expr
+	True  *Block
+	False *Block
+}
+
+// Step is one action of a block: an assignment, a procedure call, the
+// test of a condition or case selector, or the setting, testing or
+// stepping of a for loop's control variable. Stmt is the statement the
+// step is part of and Line its line, except that the test of a repeat
+// loop is on the line of its until part.
+//
+// Exprs are the expressions the step evaluates and Reads the variables
+// they read, in order. Def is the variable the step assigns to, or nil,
+// and Value the value it assigns, when known. Whole is false when only
+// an element or field of Def is assigned. Cond is the condition tested
+// by an if, while, repeat or for statement.
+type Step struct {
+	Line  int
+	Stmt  ast.Stmt
+	Exprs []ast.Expr
+	Reads []*Symbol
+	Def   *Symbol
+	Value ast.Expr
+	Whole bool
+	Cond  ast.Expr
+}
+
+// loop holds the targets of break and continue in the innermost loop.
+type loop struct {
+	breakTo    *Block
+	continueTo *Block
+}
+
+type builder struct {
+	graph   *Graph
+	current *Block
+	loops   []loop
+}
+
+// New builds the control-flow graph of body. A statement that follows
+// break, continue or exit starts a block without predecessors, and a
+// condition whose value is known at compile time only leads to the
+// statements it selects.
+func New(body *ast.Body) *Graph {
+	b := &builder{graph: &Graph{Body: body}}
+	b.graph.Entry = b.newBlock()
+	b.graph.Exit = b.newBlock()
+	b.current = b.graph.Entry
+
+	b.stmt(body.Block)
+	b.jump(b.current, b.graph.Exit)
+
+	return b.graph
+}
+
+func (b *builder) newBlock() *Block {
+	block := &Block{Index: len(b.graph.Blocks)}
+	b.graph.Blocks = append(b.graph.Blocks, block)
+	return block
+}
+
+func (b *builder) jump(from *Block, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// next ends the current block with a jump to a new block and continues
+// in the new block.
+func (b *builder) next() *Block {
+	block := b.newBlock()
+	b.jump(b.current, block)
+	b.current = block
+	return block
+}
+
+func (b *builder) add(step *Step) {
+	b.current.Steps = append(b.current.Steps, step)
+}
+
+// eval adds a step evaluating exprs.
+func (b *builder) eval(stmt ast.Stmt, exprs ...ast.Expr) {
+	step := &Step{Line: stmt.Line(), Stmt: stmt, Exprs: exprs}
+	for _, expr := range exprs {
+		step.Reads = reads(expr, step.Reads)
+	}
+	b.add(step)
+}
+
+// assign adds a step assigning value to x as part of stmt.
+func (b *builder) assign(stmt ast.Stmt, x ast.Expr, value ast.Expr) {
+	step := &Step{Line: stmt.Line(), Stmt: stmt, Exprs: []ast.Expr{x, value}, Value: value}
+	step.Def, step.Whole, step.Reads = target(x, reads(value, nil))
+	b.add(step)
+}
+
+// test adds a step testing cond on line to the current block, which then
+// jumps to ifTrue or ifFalse.
+func (b *builder) test(stmt ast.Stmt, line int, cond ast.Expr, ifTrue *Block, ifFalse *Block) {
+	b.add(&Step{Line: line, Stmt: stmt, Exprs: []ast.Expr{cond}, Reads: reads(cond, nil), Cond: cond})
+	b.current.Cond, b.current.True, b.current.False = cond, ifTrue, ifFalse
+
+	value, known := ast.BoolValue(cond)
+	if !known || value {
+		b.jump(b.current, ifTrue)
+	}
+	if !known || !value {
+		b.jump(b.current, ifFalse)
+	}
+}
+
+func (b *builder) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.Block:
+		for _, inner := range s.List {
+			b.stmt(inner)
+		}
+	case *ast.Assign:
+		b.assign(s, s.X, s.Value)
+	case *ast.ProcCall:
+		b.call(s)
+	case *ast.If:
+		then := b.newBlock()
+		join := b.newBlock()
+		els := join
+		if s.Else != nil {
+			els = b.newBlock()
+		}
+		b.test(s, s.Line(), s.Cond, then, els)
+
+		b.current = then
+		b.stmt(s.Then)
+		b.jump(b.current, join)
+
+		if s.Else != nil {
+			b.current = els
+			b.stmt(s.Else)
+			b.jump(b.current, join)
+		}
+		b.current = join
+	case *ast.While:
+		header := b.next()
+		body := b.newBlock()
+		after := b.newBlock()
+		b.test(s, s.Line(), s.Cond, body, after)
+
+		b.current = body
+		b.loop(s.Body, after, header)
+		b.jump(b.current, header)
+		b.current = after
+	case *ast.For:
+		// The loop runs as if it were written with a hidden variable
+		// holding the final value, which is evaluated once:
+		//	limit := final; control := initial;
+		//	while control <= limit do begin body; control := control + 1 end
+		// with >= and - 1 for a downto loop.
+		typ := s.Control.Type()
+		limit := ast.NewIdent("limit", NewSymbol("limit", VariableSym, typ), typ)
+		test, step := LESS_EQ, ADD
+		if s.Down {
+			test, step = GREATER_EQ, SUB
+		}
+
+		b.assign(s, limit, s.Final)
+		b.assign(s, s.Control, s.Initial)
+
+		header := b.next()
+		body := b.newBlock()
+		increment := b.newBlock()
+		after := b.newBlock()
+		b.test(s, s.Line(), ast.NewBinary(test, s.Control, limit, types.Boolean), body, after)
+
+		b.current = body
+		b.loop(s.Body, after, increment)
+		b.jump(b.current, increment)
+
+		b.current = increment
+		b.assign(s, s.Control, ast.NewBinary(step, s.Control, ast.NewLiteral(constant.MakeInt64(1), types.Integer), typ))
+		b.jump(increment, header)
+		b.current = after
+	case *ast.Repeat:
+		b.next()
+		body := b.current
+		cond := b.newBlock()
+		after := b.newBlock()
+
+		b.loop(s.Body, after, cond)
+		b.jump(b.current, cond)
+
+		b.current = cond
+		b.test(s, s.CondLine(), s.Cond, after, body)
+		b.current = after
+	case *ast.Case:
+		b.eval(s, s.Selector)
+		selector := b.current
+		after := b.newBlock()
+
+		for _, clause := range s.Clauses {
+			b.current = b.newBlock()
+			b.jump(selector, b.current)
+			b.stmt(clause.Body)
+			b.jump(b.current, after)
+		}
+
+		if s.Else != nil {
+			b.current = b.newBlock()
+			b.jump(selector, b.current)
+			b.stmt(s.Else)
+			b.jump(b.current, after)
+		} else {
+			b.jump(selector, after)
+		}
+		b.current = after
+	case *ast.Branch:
+		switch {
+		case s.Kind == ast.Exit:
+			b.jump(b.current, b.graph.Exit)
+		case len(b.loops) == 0:
+			// Reported by the parser.
+		case s.Kind == ast.Break:
+			b.jump(b.current, b.loops[len(b.loops)-1].breakTo)
+		case s.Kind == ast.Continue:
+			b.jump(b.current, b.loops[len(b.loops)-1].continueTo)
+		}
+		b.current = b.newBlock()
+	}
+}
+
+// loop adds the body of a loop, with break jumping to breakTo and
+// continue to continueTo.
+func (b *builder) loop(body ast.Stmt, breakTo *Block, continueTo *Block) {
+	b.loops = append(b.loops, loop{breakTo, continueTo})
+	b.stmt(body)
+	b.loops = b.loops[:len(b.loops)-1]
+}
+
+// call adds a procedure call. Arguments are passed by value, so they are
+// only read, except that new assigns to its argument.
+func (b *builder) call(call *ast.ProcCall) {
+	if call.Proc == nil && call.Name == "new" && len(call.Args) == 1 {
+		step := &Step{Line: call.Line(), Stmt: call, Exprs: call.Args}
+		step.Def, step.Whole, step.Reads = target(call.Args[0], nil)
+		b.add(step)
+		return
+	}
+	b.eval(call, call.Args...)
+}
+
+// reads appends the variables expr reads to list.
+func reads(expr ast.Expr, list []*Symbol) []*Symbol {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		if x.Symbol != nil {
+			list = append(list, x.Symbol)
+		}
+	case *ast.Index:
+		list = reads(x.Index, reads(x.X, list))
+	case *ast.Selector:
+		list = reads(x.X, list)
+	case *ast.Deref:
+		list = reads(x.X, list)
+	case *ast.Set:
+		for _, elem := range x.Elems {
+			list = reads(elem, list)
+		}
+	case *ast.Range:
+		list = reads(x.High, reads(x.Low, list))
+	case *ast.Unary:
+		list = reads(x.X, list)
+	case *ast.Binary:
+		list = reads(x.Y, reads(x.X, list))
+	case *ast.Call:
+		for _, arg := range x.Args {
+			list = reads(arg, list)
+		}
+	}
+	return list
+}
+
+// target returns the variable that assigning to expr changes and
+// whether all of it is changed, and appends the variables read to find
+// it, such as indices, to list. Assigning through a pointer changes no
+// variable and reads the pointer.
+func target(expr ast.Expr, list []*Symbol) (*Symbol, bool, []*Symbol) {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Symbol, true, list
+	case *ast.Index:
+		def, _, list := target(x.X, list)
+		return def, false, reads(x.Index, list)
+	case *ast.Selector:
+		def, _, list := target(x.X, list)
+		return def, false, list
+	}
+	return nil, false, reads(expr, list)
+}
+
+// Reachable returns the blocks that can be reached from the entry.
+func (graph *Graph) Reachable() map[*Block]bool {
+	seen := map[*Block]bool{graph.Entry: true}
+	work := []*Block{graph.Entry}
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range block.Succs {
+			if !seen[succ] {
+				seen[succ] = true
+				work = append(work, succ)
+			}
+		}
+	}
+	return seen
+}
+
+// Cyclic returns the blocks that lie on a loop, from which the block
+// itself can be reached again.
+func (graph *Graph) Cyclic() map[*Block]bool {
+	cyclic := make(map[*Block]bool)
+	for _, block := range graph.Blocks {
+		seen := make(map[*Block]bool)
+		work := append([]*Block(nil), block.Succs...)
+		for len(work) > 0 && !cyclic[block] {
+			next := work[len(work)-1]
+			work = work[:len(work)-1]
+			if next == block {
+				cyclic[block] = true
+			} else if !seen[next] {
+				seen[next] = true
+				work = append(work, next.Succs...)
+			}
+		}
+	}
+	return cyclic
+}
+
+// Loop returns the blocks that lie on a loop with block: those that can
+// be reached from block and from which block can be reached again. It
+// is empty when block does not lie on a loop.
+func (graph *Graph) Loop(block *Block) map[*Block]bool {
+	reach := func(next func(*Block) []*Block) map[*Block]bool {
+		seen := make(map[*Block]bool)
+		work := append([]*Block(nil), next(block)...)
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			if !seen[b] {
+				seen[b] = true
+				work = append(work, next(b)...)
+			}
+		}
+		return seen
+	}
+
+	forward := reach(func(b *Block) []*Block { return b.Succs })
+	backward := reach(func(b *Block) []*Block { return b.Preds })
+	loop := make(map[*Block]bool)
+	for b := range forward {
+		if backward[b] {
+			loop[b] = true
+		}
+	}
+	return loop
+}
@@ -0,0 +1,424 @@
+package flow
+
+import (
+	"compiler/ast"
+	"compiler/types"
+	. "compiler/util"
+	"math"
+)
+
+// Interval is the range of values an integer expression can take, from
+// Lo to Hi inclusive. The ends are floats so that they can be infinite
+// and so that arithmetic on them cannot overflow. An interval with Lo
+// greater than Hi is empty.
+type Interval struct {
+	Lo float64
+	Hi float64
+}
+
+var (
+	top      = Interval{math.Inf(-1), math.Inf(1)}
+	intRange = Interval{types.MinInteger, types.MaxInteger}
+)
+
+func point(n float64) Interval {
+	return Interval{n, n}
+}
+
+func (x Interval) IsEmpty() bool {
+	return x.Lo > x.Hi
+}
+
+// Contains reports whether every value in y is also in x.
+func (x Interval) Contains(y Interval) bool {
+	return x.Lo <= y.Lo && y.Hi <= x.Hi
+}
+
+func (x Interval) Has(n float64) bool {
+	return x.Lo <= n && n <= x.Hi
+}
+
+func (x Interval) Meet(y Interval) Interval {
+	return Interval{math.Max(x.Lo, y.Lo), math.Min(x.Hi, y.Hi)}
+}
+
+func (x Interval) Join(y Interval) Interval {
+	if x.IsEmpty() {
+		return y
+	}
+	if y.IsEmpty() {
+		return x
+	}
+	return Interval{math.Min(x.Lo, y.Lo), math.Max(x.Hi, y.Hi)}
+}
+
+// Widen moves an end of x that y goes past out to infinity, so that the
+// values of a variable changed in a loop settle after a few passes. An
+// infinite end means that nothing is known about how far the values go,
+// which the checks tell apart from values that reach the end of the
+// variable's type.
+func (x Interval) Widen(y Interval) Interval {
+	if x.IsEmpty() {
+		return y
+	}
+	w := x.Join(y)
+	if y.Lo < x.Lo {
+		w.Lo = math.Inf(-1)
+	}
+	if y.Hi > x.Hi {
+		w.Hi = math.Inf(1)
+	}
+	return w
+}
+
+// Saturate cuts the finite ends of x off at the ends of limit. Infinite
+// ends are kept.
+func (x Interval) Saturate(limit Interval) Interval {
+	if !math.IsInf(x.Lo, 0) {
+		x.Lo = math.Min(math.Max(x.Lo, limit.Lo), limit.Hi)
+	}
+	if !math.IsInf(x.Hi, 0) {
+		x.Hi = math.Max(math.Min(x.Hi, limit.Hi), limit.Lo)
+	}
+	return x
+}
+
+func (x Interval) Neg() Interval {
+	return Interval{-x.Hi, -x.Lo}
+}
+
+func (x Interval) Add(y Interval) Interval {
+	return Interval{x.Lo + y.Lo, x.Hi + y.Hi}
+}
+
+func (x Interval) Sub(y Interval) Interval {
+	return x.Add(y.Neg())
+}
+
+func (x Interval) Mul(y Interval) Interval {
+	return corners(x, y, func(a, b float64) float64 {
+		if a == 0 || b == 0 {
+			return 0
+		}
+		return a * b
+	})
+}
+
+// Div is integer division, which truncates towards zero. A divisor
+// that may be zero gives no information about the result.
+func (x Interval) Div(y Interval) Interval {
+	if y.Has(0) {
+		return top
+	}
+	return corners(x, y, func(a, b float64) float64 {
+		if math.IsInf(a, 0) || math.IsInf(b, 0) {
+			return a / b
+		}
+		return math.Trunc(a / b)
+	})
+}
+
+// Mod is the remainder of integer division, which has the sign of x
+// and is smaller in size than y.
+func (x Interval) Mod(y Interval) Interval {
+	if y == point(0) {
+		return top
+	}
+	m := math.Max(math.Abs(y.Lo), math.Abs(y.Hi)) - 1
+	r := Interval{-m, m}
+	if x.Lo >= 0 {
+		r.Lo = 0
+	}
+	if x.Hi <= 0 {
+		r.Hi = 0
+	}
+	return r.Meet(Interval{math.Min(x.Lo, 0), math.Max(x.Hi, 0)})
+}
+
+// corners applies op to the ends of x and y and returns the smallest
+// interval holding the results, which is right for operations that are
+// monotonic in each operand on each side of zero. A result that is not
+// a number, such as that of dividing two infinite ends, is left out.
+func corners(x Interval, y Interval, op func(a, b float64) float64) Interval {
+	if x.IsEmpty() || y.IsEmpty() {
+		return Interval{1, 0}
+	}
+	r := Interval{math.Inf(1), math.Inf(-1)}
+	for _, v := range []float64{op(x.Lo, y.Lo), op(x.Lo, y.Hi), op(x.Hi, y.Lo), op(x.Hi, y.Hi)} {
+		if !math.IsNaN(v) {
+			r.Lo, r.Hi = math.Min(r.Lo, v), math.Max(r.Hi, v)
+		}
+	}
+	if r.IsEmpty() {
+		return top
+	}
+	return r
+}
+
+// Format formats x as [lo, hi], with enumerator names for the values of
+// an enumerated type t. The ends are saturated at the range of t, so
+// that an end that is unknown or past the range is shown as its limit.
+func (x Interval) Format(t types.Type) string {
+	end := func(n float64) string {
+		switch {
+		case math.IsInf(n, -1):
+			return "-inf"
+		case math.IsInf(n, 1):
+			return "+inf"
+		}
+		return types.OrdinalString(t, int(n))
+	}
+
+	if x.IsEmpty() {
+		return "[]"
+	}
+	limit := typeRange(t)
+	x = x.Saturate(limit).Meet(limit)
+	return "[" + end(x.Lo) + ", " + end(x.Hi) + "]"
+}
+
+func (x Interval) String() string {
+	return x.Format(types.Integer)
+}
+
+// typeRange returns the values a variable of type t can hold.
+func typeRange(t types.Type) Interval {
+	if low, high, ok := types.Bounds(t); ok {
+		return Interval{float64(low), float64(high)}
+	}
+	if types.IsInteger(t) {
+		return intRange
+	}
+	return top
+}
+
+// unknown returns the interval of a value of type t about which nothing
+// is known: the range of a subrange or enumerated type, but an infinite
+// one for an integer, so that the checks can tell it from values that
+// reach the limits of the type.
+func unknown(t types.Type) Interval {
+	if _, _, ok := types.Bounds(t); ok {
+		return typeRange(t)
+	}
+	return top
+}
+
+// ranged reports whether the values of sym can be followed by the
+// range analysis: it is an integer or enumerated variable or parameter.
+func ranged(sym *Symbol) bool {
+	kind := sym.GetKind()
+	return (kind == VariableSym || kind == ParameterSym) && types.IsOrdinal(sym.GetType()) && !types.IsBoolean(types.Base(sym.GetType()))
+}
+
+// state maps the variables the range analysis follows to their
+// intervals. Nothing is known about any other variable. A nil
+// state belongs to code that cannot be reached.
+type state map[*Symbol]Interval
+
+func (st state) get(sym *Symbol) Interval {
+	if x, ok := st[sym]; ok {
+		return x
+	}
+	return unknown(sym.GetType())
+}
+
+func (st state) copy() state {
+	if st == nil {
+		return nil
+	}
+	out := make(state, len(st))
+	for sym, x := range st {
+		out[sym] = x
+	}
+	return out
+}
+
+func (st state) join(other state) state {
+	if st == nil {
+		return other.copy()
+	}
+	if other == nil {
+		return st.copy()
+	}
+
+	out := make(state)
+	for sym := range st {
+		out[sym] = st.get(sym).Join(other.get(sym))
+	}
+	for sym := range other {
+		out[sym] = st.get(sym).Join(other.get(sym))
+	}
+	return out
+}
+
+func (st state) widen(next state) state {
+	if st == nil || next == nil {
+		return next.copy()
+	}
+
+	out := make(state)
+	for sym := range next {
+		out[sym] = st.get(sym).Widen(next.get(sym))
+	}
+	for sym := range st {
+		if _, ok := next[sym]; !ok {
+			out[sym] = st.get(sym).Widen(next.get(sym))
+		}
+	}
+	return out
+}
+
+func (st state) equal(other state) bool {
+	if (st == nil) != (other == nil) || len(st) != len(other) {
+		return false
+	}
+	for sym, x := range st {
+		if y, ok := other[sym]; !ok || x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// eval returns the interval of the integer expression expr.
+func (st state) eval(expr ast.Expr) Interval {
+	if value, ok := ast.IntValue(expr); ok {
+		return point(float64(value))
+	}
+
+	switch x := expr.(type) {
+	case *ast.Ident:
+		if x.Symbol != nil {
+			return st.get(x.Symbol)
+		}
+	case *ast.Unary:
+		switch x.Op {
+		case SUB:
+			return st.eval(x.X).Neg()
+		case ADD:
+			return st.eval(x.X)
+		}
+	case *ast.Binary:
+		switch x.Op {
+		case ADD:
+			return st.eval(x.X).Add(st.eval(x.Y))
+		case SUB:
+			return st.eval(x.X).Sub(st.eval(x.Y))
+		case MUL:
+			return st.eval(x.X).Mul(st.eval(x.Y))
+		case DIV:
+			return st.eval(x.X).Div(st.eval(x.Y))
+		case MOD:
+			return st.eval(x.X).Mod(st.eval(x.Y))
+		}
+	case *ast.Call:
+		if len(x.Args) == 1 {
+			switch x.Name {
+			case "ord":
+				return st.eval(x.Args[0])
+			case "succ":
+				return st.eval(x.Args[0]).Add(point(1))
+			case "pred":
+				return st.eval(x.Args[0]).Sub(point(1))
+			}
+		}
+	}
+
+	return unknown(expr.Type())
+}
+
+// refine narrows the intervals of the variables in cond to the values
+// for which cond is truth.
+func (st state) refine(cond ast.Expr, truth bool) state {
+	if st == nil {
+		return nil
+	}
+
+	switch x := cond.(type) {
+	case *ast.Unary:
+		if x.Op == NOT {
+			return st.refine(x.X, !truth)
+		}
+	case *ast.Binary:
+		switch {
+		case x.Op == AND && truth, x.Op == OR && !truth:
+			return st.refine(x.X, truth).refine(x.Y, truth)
+		case x.Op == AND || x.Op == OR:
+			return st
+		}
+
+		op := x.Op
+		if _, relational := negated[op]; !relational {
+			return st
+		}
+		if !truth {
+			op = negated[op]
+		}
+		out := st.copy()
+		out.compare(x.X, op, x.Y)
+		out.compare(x.Y, swapped[op], x.X)
+		for _, v := range out {
+			if v.IsEmpty() {
+				return nil
+			}
+		}
+		return out
+	}
+
+	return st
+}
+
+// negated and swapped give the relational operator that holds when the
+// original does not, and when its operands are exchanged.
+var negated map[AttributeType]AttributeType = map[AttributeType]AttributeType{
+	EQ: NOT_EQ, NOT_EQ: EQ, LESS: GREATER_EQ, GREATER_EQ: LESS, GREATER: LESS_EQ, LESS_EQ: GREATER,
+}
+
+var swapped map[AttributeType]AttributeType = map[AttributeType]AttributeType{
+	EQ: EQ, NOT_EQ: NOT_EQ, LESS: GREATER, GREATER: LESS, LESS_EQ: GREATER_EQ, GREATER_EQ: LESS_EQ,
+}
+
+// compare narrows the interval of x, when it is a variable, to the
+// values for which x op y holds.
+func (st state) compare(x ast.Expr, op AttributeType, y ast.Expr) {
+	ident, ok := x.(*ast.Ident)
+	if !ok {
+		return
+	}
+	if _, followed := st[ident.Symbol]; !followed {
+		return
+	}
+
+	v, w := st.get(ident.Symbol), st.eval(y)
+	switch op {
+	case EQ:
+		v = v.Meet(w)
+	case LESS:
+		v = v.Meet(Interval{math.Inf(-1), w.Hi - 1})
+	case LESS_EQ:
+		v = v.Meet(Interval{math.Inf(-1), w.Hi})
+	case GREATER:
+		v = v.Meet(Interval{w.Lo + 1, math.Inf(1)})
+	case GREATER_EQ:
+		v = v.Meet(Interval{w.Lo, math.Inf(1)})
+	case NOT_EQ:
+		if w.Lo == w.Hi && v.Lo == w.Lo {
+			v.Lo++
+		} else if w.Lo == w.Hi && v.Hi == w.Hi {
+			v.Hi--
+		}
+	}
+	st[ident.Symbol] = v
+}
+
+// assign sets the interval of sym, if it is followed, to value. A value
+// past the range of sym's type is saturated at its limits rather than
+// wrapped around: the overflow is reported where it happens, and
+// following the values it wraps to would only spread it to warnings
+// further on.
+func (st state) assign(sym *Symbol, value Interval) {
+	if _, followed := st[sym]; !followed {
+		return
+	}
+	st[sym] = value.Saturate(typeRange(sym.GetType()))
+}
@@ -0,0 +1,308 @@
+package flow
+
+import (
+	"compiler/ast"
+	"compiler/types"
+	. "compiler/util"
+	"math"
+)
+
+// ranges reports array indices that may be out of bounds, divisors that
+// may be zero and assignments in loops that may overflow. The interval
+// of each integer and enumerated local variable and parameter flows
+// forward from the entry, where nothing is known about it, and is
+// narrowed on the branches of the conditions that test it. Loop headers
+// widen a bound that keeps moving out to infinity, past the end of the
+// variable's type, and two further passes narrow it again.
+func (checker *Checker) ranges(graph *Graph) {
+	entry := make(state)
+	for sym := range checker.locals(graph, true) {
+		if ranged(sym) {
+			entry[sym] = unknown(sym.GetType())
+		}
+	}
+	for _, block := range graph.Blocks {
+		for _, step := range block.Steps {
+			// The hidden variables that hold the final value of a for loop.
+			if step.Def != nil && step.Def.GetScope() == nil && ranged(step.Def) {
+				entry[step.Def] = unknown(step.Def.GetType())
+			}
+		}
+	}
+
+	in := make(map[*Block]state)
+	out := make(map[*Block]state)
+
+	// edge returns the state on the edge from pred to block, which is nil
+	// when the edge cannot be taken.
+	edge := func(pred *Block, block *Block) state {
+		st := out[pred]
+		if pred.Cond != nil && block == pred.True {
+			st = st.refine(pred.Cond, true)
+		} else if pred.Cond != nil && block == pred.False {
+			st = st.refine(pred.Cond, false)
+		}
+		return st
+	}
+
+	input := func(block *Block) state {
+		var st state
+		if block == graph.Entry {
+			st = entry.copy()
+		}
+		for _, pred := range block.Preds {
+			st = st.join(edge(pred, block))
+		}
+		return st
+	}
+
+	pass := func(widen bool) bool {
+		changed := false
+		for _, block := range graph.Blocks {
+			st := input(block)
+			if widen && isLoopHeader(block) {
+				st = in[block].widen(in[block].join(st))
+			}
+			if !st.equal(in[block]) {
+				in[block] = st
+				changed = true
+			}
+			out[block] = checker.transfer(block, st.copy(), nil)
+		}
+		return changed
+	}
+
+	for pass(true) {
+	}
+	pass(false)
+	pass(false)
+
+	// A loop that no edge that can be taken leaves never ends, so the
+	// variables it steps go on to the ends of their types.
+	cyclic := graph.Cyclic()
+	endless := make(map[*Block]bool)
+	seen := make(map[*Block]bool)
+	for _, block := range graph.Blocks {
+		if !cyclic[block] || seen[block] {
+			continue
+		}
+		loop := graph.Loop(block)
+		for b := range loop {
+			seen[b] = true
+			endless[b] = !leaves(loop, edge)
+		}
+	}
+
+	for _, block := range graph.Blocks {
+		if in[block] == nil {
+			continue
+		}
+		checker.transfer(block, in[block].copy(), func(step *Step, st state) {
+			for _, expr := range step.Exprs {
+				checker.checkRanges(step.Line, expr, st)
+			}
+			if cyclic[block] {
+				checker.checkOverflow(step, st, endless[block])
+			}
+		})
+	}
+}
+
+// leaves reports whether an edge that can be taken, as told by edge,
+// goes from a block of loop to a block outside it.
+func leaves(loop map[*Block]bool, edge func(*Block, *Block) state) bool {
+	for block := range loop {
+		for _, succ := range block.Succs {
+			if !loop[succ] && edge(block, succ) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// transfer runs the steps of block on st, calling check, if it is not
+// nil, before each step.
+func (checker *Checker) transfer(block *Block, st state, check func(*Step, state)) state {
+	if st == nil {
+		return nil
+	}
+
+	for _, step := range block.Steps {
+		if check != nil {
+			check(step, st)
+		}
+		if step.Def == nil || !step.Whole {
+			continue
+		}
+		if step.Value != nil {
+			st.assign(step.Def, st.eval(step.Value))
+		} else if _, followed := st[step.Def]; followed {
+			st[step.Def] = unknown(step.Def.GetType())
+		}
+	}
+	return st
+}
+
+// isLoopHeader reports whether a jump back from later in the body enters
+// block. Blocks are numbered in the order of the statements they belong
+// to, so these are the blocks at the start of loops.
+func isLoopHeader(block *Block) bool {
+	for _, pred := range block.Preds {
+		if pred.Index >= block.Index {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRanges reports the indices and divisors in expr that may be out
+// of bounds or zero.
+func (checker *Checker) checkRanges(line int, expr ast.Expr, st state) {
+	switch x := expr.(type) {
+	case *ast.Index:
+		checker.checkRanges(line, x.X, st)
+		checker.checkRanges(line, x.Index, st)
+		checker.checkIndex(line, x, st)
+	case *ast.Selector:
+		checker.checkRanges(line, x.X, st)
+	case *ast.Deref:
+		checker.checkRanges(line, x.X, st)
+	case *ast.Set:
+		for _, elem := range x.Elems {
+			checker.checkRanges(line, elem, st)
+		}
+	case *ast.Range:
+		checker.checkRanges(line, x.Low, st)
+		checker.checkRanges(line, x.High, st)
+	case *ast.Unary:
+		checker.checkRanges(line, x.X, st)
+	case *ast.Binary:
+		checker.checkRanges(line, x.X, st)
+		checker.checkRanges(line, x.Y, st)
+		if x.Op == DIV || x.Op == MOD {
+			checker.checkDivisor(line, x.Y, st)
+		}
+	case *ast.Call:
+		for _, arg := range x.Args {
+			checker.checkRanges(line, arg, st)
+		}
+	}
+}
+
+// checkIndex reports an index whose interval is not within the bounds of
+// the array. Constant indices are checked by the parser, and an index
+// about which nothing is known is not reported.
+func (checker *Checker) checkIndex(line int, x *ast.Index, st state) {
+	if _, constant := ast.IntValue(x.Index); constant {
+		return
+	}
+
+	var bounds Interval
+	var boundsStr string
+	switch array := x.X.Type().(type) {
+	case *types.Array:
+		bounds = Interval{float64(array.Low), float64(array.High)}
+		boundsStr = types.OrdinalString(array.Index, array.Low) + ".." + types.OrdinalString(array.Index, array.High)
+	case *types.OpenArray:
+		bounds = Interval{0, math.Inf(1)}
+		boundsStr = "0..high"
+	default:
+		return
+	}
+
+	value := st.eval(x.Index)
+	if value.IsEmpty() || bounds.Contains(value) || value.Contains(typeRange(x.Index.Type())) {
+		return
+	}
+
+	verb := "may be"
+	if bounds.Meet(value).IsEmpty() {
+		verb = "is"
+	}
+	checker.listing.AddWarning(line, IndexRange, "Array index "+describe(x.Index)+verb+" out of range "+boundsStr+", its value is in "+value.Format(x.Index.Type()))
+}
+
+// checkDivisor reports a divisor of div or mod whose interval holds 0.
+// A divisor about which nothing is known, such as an integer parameter
+// that is never tested, is deliberately not reported, like such an
+// index; otherwise most divisions would be.
+func (checker *Checker) checkDivisor(line int, divisor ast.Expr, st state) {
+	value := st.eval(divisor)
+	switch {
+	case value == point(0):
+		checker.listing.AddWarning(line, DivisionByZero, "Divisor "+describe(divisor)+"is always zero")
+	case value.Has(0) && !value.Contains(typeRange(divisor.Type())):
+		checker.listing.AddWarning(line, DivisionByZero, "Divisor "+describe(divisor)+"may be zero, its value is in "+value.String())
+	}
+}
+
+// checkOverflow reports an assignment in a loop that computes a variable
+// from its own value, such as i := i + 1 or sum := sum + i, when the new
+// value may not fit in the variable's type. An infinite end of the value,
+// which widening has moved out or which comes from a variable nothing is
+// known about, is not reported unless the loop is endless and the
+// assignment moves the value towards that end, since otherwise nothing
+// is known about how far it goes. The stepping of a for loop's control
+// variable stops at the final value, so it is not checked.
+func (checker *Checker) checkOverflow(step *Step, st state, endless bool) {
+	if _, ok := step.Stmt.(*ast.Assign); !ok || step.Def == nil || step.Value == nil {
+		return
+	}
+	if _, followed := st[step.Def]; !followed || !readsSymbol(step.Value, step.Def) {
+		return
+	}
+
+	typ := step.Def.GetType()
+	limit := typeRange(typ)
+	value := st.eval(step.Value)
+	up, down := false, false
+	if endless {
+		up, down = moves(step, st)
+	}
+	above := value.Hi > limit.Hi && (!math.IsInf(value.Hi, 1) || up)
+	below := value.Lo < limit.Lo && (!math.IsInf(value.Lo, -1) || down)
+
+	var past string
+	switch {
+	case value.IsEmpty():
+		return
+	case above && below:
+		past = "outside " + types.OrdinalString(typ, int(limit.Lo)) + ".." + types.OrdinalString(typ, int(limit.Hi))
+	case above:
+		past = "above " + types.OrdinalString(typ, int(limit.Hi))
+	case below:
+		past = "below " + types.OrdinalString(typ, int(limit.Lo))
+	default:
+		return
+	}
+	name := step.Def.GetName()
+	checker.listing.AddWarning(step.Line, Overflow, "Value assigned to "+name+" may go "+past+", "+name+" is in "+st.get(step.Def).Format(typ)+" before the assignment")
+}
+
+// moves reports whether the assignment in step may raise and may lower
+// the value of the variable it assigns to, by trying it on the value 1.
+func moves(step *Step, st state) (up bool, down bool) {
+	trial := st.copy()
+	trial[step.Def] = point(1)
+	value := trial.eval(step.Value)
+	return value.Hi > 1, value.Lo < 1
+}
+
+func readsSymbol(expr ast.Expr, sym *Symbol) bool {
+	for _, read := range reads(expr, nil) {
+		if read == sym {
+			return true
+		}
+	}
+	return false
+}
+
+// describe names expr in a warning, followed by a space, if it is a
+// variable or constant.
+func describe(expr ast.Expr) string {
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name + " "
+	}
+	return ""
+}
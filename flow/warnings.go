@@ -0,0 +1,339 @@
+package flow
+
+import (
+	"compiler/ast"
+	. "compiler/util"
+	"strconv"
+)
+
+// symbolSet is a set of variables, used as a dataflow fact.
+type symbolSet map[*Symbol]bool
+
+func (set symbolSet) copy() symbolSet {
+	out := make(symbolSet, len(set))
+	for sym := range set {
+		out[sym] = true
+	}
+	return out
+}
+
+func (set symbolSet) equal(other symbolSet) bool {
+	if len(set) != len(other) {
+		return false
+	}
+	for sym := range set {
+		if !other[sym] {
+			return false
+		}
+	}
+	return true
+}
+
+// Checker runs the analyses that look at whole procedures once parsing
+// has finished, and adds what they find to the listing as warnings.
+type Checker struct {
+	root     *GreenNode
+	graphs   []*Graph
+	listing  *ListingFile
+	exported map[*Symbol]bool
+	captured symbolSet
+	called   map[*GreenNode]bool
+}
+
+// NewChecker builds the control-flow graph of every body. Symbols in
+// exported belong to a unit's interface and are not reported as unused,
+// since other units may use them.
+func NewChecker(root *GreenNode, bodies []*ast.Body, exported map[*Symbol]bool, listing *ListingFile) *Checker {
+	checker := &Checker{root: root, listing: listing, exported: exported, captured: make(symbolSet), called: make(map[*GreenNode]bool)}
+
+	for _, body := range bodies {
+		graph := New(body)
+		checker.graphs = append(checker.graphs, graph)
+
+		for _, block := range graph.Blocks {
+			for _, step := range block.Steps {
+				checker.capture(body.Scope, step.Reads...)
+				checker.capture(body.Scope, step.Def)
+
+				if call, ok := step.Stmt.(*ast.ProcCall); ok && call.Proc != nil && call.Proc != body.Scope {
+					checker.called[call.Proc] = true
+				}
+			}
+		}
+	}
+
+	return checker
+}
+
+// capture records the variables used by a procedure nested in the
+// scope they are declared in. Calls can read and assign them at any
+// point, so they are left out of the checks on their own scope's body.
+func (checker *Checker) capture(scope *GreenNode, syms ...*Symbol) {
+	for _, sym := range syms {
+		if sym != nil && sym.GetScope() != scope {
+			checker.captured[sym] = true
+		}
+	}
+}
+
+// Check runs every analysis.
+func (checker *Checker) Check() {
+	checker.unused(checker.root)
+	for _, graph := range checker.graphs {
+		checker.constantConditions(graph)
+		checker.unreachable(graph)
+		checker.uninitialized(graph)
+		checker.deadAssignments(graph)
+		checker.ranges(graph)
+	}
+}
+
+// constantConditions reports if, while and repeat statements whose
+// condition has the same value every time it is tested.
+func (checker *Checker) constantConditions(graph *Graph) {
+	reachable := graph.Reachable()
+	for _, block := range graph.Blocks {
+		for _, step := range block.Steps {
+			if step.Cond == nil || !reachable[block] {
+				continue
+			}
+			if value, known := ast.BoolValue(step.Cond); known {
+				checker.listing.AddWarning(step.Line, ConstantCondition, "Condition is always "+strconv.FormatBool(value))
+			}
+		}
+	}
+}
+
+// unreachable reports statements that can never run. Each unreachable
+// region of the graph is reported once, on its first line.
+func (checker *Checker) unreachable(graph *Graph) {
+	reachable := graph.Reachable()
+	seen := make(map[*Block]bool)
+
+	var visit func(block *Block, first int) int
+	visit = func(block *Block, first int) int {
+		if seen[block] || reachable[block] {
+			return first
+		}
+		seen[block] = true
+
+		for _, step := range block.Steps {
+			if first == 0 || step.Line < first {
+				first = step.Line
+			}
+		}
+		for _, succ := range block.Succs {
+			first = visit(succ, first)
+		}
+		return first
+	}
+
+	// Regions are entered at a block without unreachable predecessors,
+	// except for a loop that nothing jumps into, which is entered anywhere.
+	for _, start := range []bool{true, false} {
+		for _, block := range graph.Blocks {
+			if reachable[block] || seen[block] || start && !startsRegion(block, reachable) {
+				continue
+			}
+			if line := visit(block, 0); line != 0 {
+				checker.listing.AddWarning(line, Unreachable, "Unreachable code")
+			}
+		}
+	}
+}
+
+// startsRegion reports whether the unreachable block has no unreachable
+// predecessors, other than itself through a loop.
+func startsRegion(block *Block, reachable map[*Block]bool) bool {
+	for _, pred := range block.Preds {
+		if !reachable[pred] && pred != block {
+			return false
+		}
+	}
+	return true
+}
+
+// unused reports variables and parameters that are never read and
+// procedures that are never called from outside themselves.
+func (checker *Checker) unused(node *GreenNode) {
+	for _, blueNode := range node.GetVars() {
+		sym := blueNode.GetSymbol()
+		if checker.exported[sym] || len(sym.GetReads()) > 0 {
+			continue
+		}
+
+		switch {
+		case sym.GetKind() == ParameterSym:
+			checker.listing.AddWarning(sym.GetLine(), Unused, "Parameter "+sym.GetName()+" is never used")
+		case sym.GetKind() != VariableSym:
+		case len(sym.GetWrites()) > 0:
+			checker.listing.AddWarning(sym.GetLine(), Unused, "Variable "+sym.GetName()+" is assigned but never used")
+		default:
+			checker.listing.AddWarning(sym.GetLine(), Unused, "Variable "+sym.GetName()+" is never used")
+		}
+	}
+
+	for _, child := range node.GetChildren() {
+		sym := child.GetSymbol()
+		if !checker.exported[sym] && !checker.called[child] {
+			checker.listing.AddWarning(sym.GetLine(), Uncalled, "Procedure "+sym.GetName()+" is never called")
+		}
+		checker.unused(child)
+	}
+}
+
+// locals returns the variables, and the parameters as well if params is
+// true, of the scope of graph that neither a nested procedure nor
+// another unit can use.
+func (checker *Checker) locals(graph *Graph, params bool) symbolSet {
+	set := make(symbolSet)
+	for _, blueNode := range graph.Body.Scope.GetVars() {
+		sym := blueNode.GetSymbol()
+		kind := sym.GetKind()
+		if (kind == VariableSym || params && kind == ParameterSym) && !checker.captured[sym] && !checker.exported[sym] {
+			set[sym] = true
+		}
+	}
+	return set
+}
+
+// uninitialized reports variables that may be read before they are
+// assigned. The set of variables that may not have been assigned yet
+// flows forward from the entry, where it holds every local variable.
+// Assigning to part of a variable counts as assigning it.
+func (checker *Checker) uninitialized(graph *Graph) {
+	locals := checker.locals(graph, false)
+	if len(locals) == 0 {
+		return
+	}
+
+	reachable := graph.Reachable()
+	in := make(map[*Block]symbolSet)
+	out := make(map[*Block]symbolSet)
+	for _, block := range graph.Blocks {
+		out[block] = make(symbolSet)
+	}
+
+	transfer := func(block *Block, set symbolSet, report func(*Step, *Symbol)) {
+		for _, step := range block.Steps {
+			for _, sym := range step.Reads {
+				if set[sym] && report != nil {
+					report(step, sym)
+				}
+			}
+			delete(set, step.Def)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, block := range graph.Blocks {
+			set := make(symbolSet)
+			if block == graph.Entry {
+				set = locals.copy()
+			}
+			for _, pred := range block.Preds {
+				for sym := range out[pred] {
+					set[sym] = true
+				}
+			}
+
+			in[block] = set.copy()
+			transfer(block, set, nil)
+			if !set.equal(out[block]) {
+				out[block] = set
+				changed = true
+			}
+		}
+	}
+
+	// Each variable is reported once, on the first line it may be read
+	// uninitialized on.
+	first := make(map[*Symbol]int)
+	for _, block := range graph.Blocks {
+		if !reachable[block] {
+			continue
+		}
+		transfer(block, in[block].copy(), func(step *Step, sym *Symbol) {
+			if line, ok := first[sym]; !ok || step.Line < line {
+				first[sym] = step.Line
+			}
+		})
+	}
+
+	for _, blueNode := range graph.Body.Scope.GetVars() {
+		sym := blueNode.GetSymbol()
+		if line, ok := first[sym]; ok {
+			checker.listing.AddWarning(line, Uninitialized, "Variable "+sym.GetName()+" may be read before it is assigned")
+		}
+	}
+}
+
+// deadAssignments reports assignments whose value is never read because
+// the variable is assigned again, or the body returns, first. The set of
+// live variables flows backwards from the exit, where none are live.
+// Variables that are never read at all are reported as unused instead.
+func (checker *Checker) deadAssignments(graph *Graph) {
+	locals := checker.locals(graph, true)
+	for sym := range locals {
+		if len(sym.GetReads()) == 0 {
+			delete(locals, sym)
+		}
+	}
+	if len(locals) == 0 {
+		return
+	}
+
+	reachable := graph.Reachable()
+	in := make(map[*Block]symbolSet)
+	for _, block := range graph.Blocks {
+		in[block] = make(symbolSet)
+	}
+
+	transfer := func(block *Block, live symbolSet, report func(*Step)) {
+		for i := len(block.Steps) - 1; i >= 0; i-- {
+			step := block.Steps[i]
+			if step.Def != nil && step.Whole {
+				if locals[step.Def] && !live[step.Def] && report != nil {
+					report(step)
+				}
+				delete(live, step.Def)
+			}
+			for _, sym := range step.Reads {
+				live[sym] = true
+			}
+		}
+	}
+
+	liveOut := func(block *Block) symbolSet {
+		live := make(symbolSet)
+		for _, succ := range block.Succs {
+			for sym := range in[succ] {
+				live[sym] = true
+			}
+		}
+		return live
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(graph.Blocks) - 1; i >= 0; i-- {
+			block := graph.Blocks[i]
+			live := liveOut(block)
+			transfer(block, live, nil)
+			if !live.equal(in[block]) {
+				in[block] = live
+				changed = true
+			}
+		}
+	}
+
+	for _, block := range graph.Blocks {
+		if !reachable[block] {
+			continue
+		}
+		transfer(block, liveOut(block), func(step *Step) {
+			checker.listing.AddWarning(step.Line, DeadAssignment, "Value assigned to "+step.Def.GetName()+" is never read")
+		})
+	}
+}
@@ -1,10 +1,20 @@
 package parser
 
 import (
+	"compiler/ast"
+	"compiler/flow"
 	. "compiler/scanner"
+	"compiler/types"
 	. "compiler/util"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"go/constant"
+	"go/token"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	_ "reflect"
 	"strconv"
 	"strings"
@@ -18,13 +28,88 @@ type Parser struct {
 	memory    *MemoryOffsetList
 	tokenFile []byte
 	tok       Token
+	line      int
 	scope     *ScopeTree
+	controls  []*BlueNode
+	loops     int
+	bodies    []*ast.Body
+	pointers  []*pendingPointer
 	delay     bool
 	newline   bool
+
+	dialect    Dialect
+	xref       bool
+	callGraph  bool
+	scopeGraph bool
+	nowarn     []WarningKind
+	file       string
+	units      map[string]*GreenNode
+	uses       []string
+	exports    *UnitFile
+	exported   map[*Symbol]bool
+	interfaces int
+}
+
+// Dialect selects the statement syntax the parser accepts. Legacy
+// requires the call keyword for procedure calls and treats every other
+// statement that starts with an identifier as an assignment. Standard
+// looks the identifier up: a procedure starts a call and a variable
+// starts an assignment. The call keyword is accepted in both.
+type Dialect uint
+
+const (
+	Legacy Dialect = iota
+	Standard
+)
+
+var DialectStrings map[Dialect]string = map[Dialect]string{
+	Legacy:   "legacy",
+	Standard: "standard",
+}
+
+// ParseDialect returns the dialect called name.
+func ParseDialect(name string) (Dialect, error) {
+	for dialect, str := range DialectStrings {
+		if str == name {
+			return dialect, nil
+		}
+	}
+	return Legacy, fmt.Errorf("Unknown dialect %s", name)
+}
+
+func (dialect Dialect) String() string {
+	return DialectStrings[dialect]
 }
 
 func NewParser(scanner *Scanner) Parser {
-	return Parser{scanner: scanner}
+	return Parser{scanner: scanner, units: make(map[string]*GreenNode)}
+}
+
+func (parser *Parser) SetDialect(dialect Dialect) {
+	parser.dialect = dialect
+}
+
+// SuppressWarning turns off warnings of the given kind.
+func (parser *Parser) SuppressWarning(kind WarningKind) {
+	parser.nowarn = append(parser.nowarn, kind)
+}
+
+// SetCrossReference makes Begin write a cross-reference of every symbol
+// to xref.txt and xref.json.
+func (parser *Parser) SetCrossReference(xref bool) {
+	parser.xref = xref
+}
+
+// SetCallGraph makes Begin write the call graph to callgraph.dot and
+// callgraph.json.
+func (parser *Parser) SetCallGraph(callGraph bool) {
+	parser.callGraph = callGraph
+}
+
+// SetScopeGraph makes Begin write the scope tree, with the layout of
+// every frame, to scope_tree.dot.
+func (parser *Parser) SetScopeGraph(scopeGraph bool) {
+	parser.scopeGraph = scopeGraph
 }
 
 func (parser *Parser) Begin(file string) {
@@ -33,20 +118,46 @@ func (parser *Parser) Begin(file string) {
 	source := ReadFile(file)
 
 	parser.listing = listing
+	for _, kind := range parser.nowarn {
+		listing.Suppress(kind)
+	}
 	parser.memory = NewMemoryOffsetList()
 	parser.source = source
 	parser.tokenFile = tokenFile
+	parser.file = file
 
 	parser.scope = NewScopeTree()
 
-	parser.program()
+	parser.compilation_unit()
+
+	// Warnings about a program with errors would mostly repeat them.
+	if parser.listing.ErrorCount() == 0 {
+		flow.NewChecker(parser.scope.GetRoot(), parser.bodies, parser.exported, parser.listing).Check()
+	}
+	// The call graph is written even with errors, like the scope tree, so
+	// that it never lags behind the source. Calls that could not be
+	// resolved are left out.
+	if parser.callGraph {
+		flow.NewCallGraph(parser.scope.GetRoot(), parser.bodies).Write()
+	}
+
+	if parser.exports != nil && parser.listing.ErrorCount() == 0 {
+		parser.exports.Interface = parser.interfaceHash(file)
+		parser.exports.Save(unitFileName(file, parser.exports.Name))
+	}
 
-	parser.scope.GetRoot().GetMemoryOffset(parser.memory)
+	parser.memory.AddFrames(parser.scope.GetRoot().Frames())
+	if parser.scopeGraph {
+		parser.scope.GetRoot().WriteDot()
+	}
 	parser.memory.WriteMemoryOffsetFile()
 
 	// ioutil.WriteFile(GenerateTimeString(time.Now())+"_token_file.txt", parser.tokenFile, 0644)
 	ioutil.WriteFile("token_file.txt", parser.tokenFile, 0644)
 	parser.scanner.SymbolTable().Write()
+	if parser.xref {
+		parser.scanner.SymbolTable().WriteCrossReference()
+	}
 	parser.memory.WriteMemoryOffsetFile()
 	parser.listing.Save()
 }
@@ -81,6 +192,7 @@ func (parser *Parser) nextTok() {
 		line := parser.scanner.CurrentLineNumber() + 1
 
 		if tok.Type() != WS {
+			parser.line = line
 			newTokenFile := append(parser.tokenFile, []byte(strconv.Itoa(line)+": "+tok.String()+"\n")...)
 			parser.tokenFile = newTokenFile
 		}
@@ -91,7 +203,7 @@ func (parser *Parser) nextTok() {
 	}
 }
 
-func (parser *Parser) accept(t interface{}) bool {
+func (parser *Parser) skip() {
 	for parser.tok.Type() == WS {
 		parser.nextTok()
 	}
@@ -99,6 +211,16 @@ func (parser *Parser) accept(t interface{}) bool {
 	for parser.tok.Type() == LEXERR {
 		parser.nextTok()
 	}
+}
+
+// currentLine returns the source line of the next token to be parsed.
+func (parser *Parser) currentLine() int {
+	parser.skip()
+	return parser.line
+}
+
+func (parser *Parser) accept(t interface{}) bool {
+	parser.skip()
 
 	switch sym := t.(type) {
 	case TokenType:
@@ -166,8 +288,15 @@ func (parser *Parser) sync(t ...interface{}) {
 	}
 }
 
-func (parser *Parser) CheckType(value AttributeType, checked AttributeType, msg string) bool {
-	if value != value&checked {
+// CheckType reports a semantic error and returns true when value is not
+// identical to checked. Invalid types have already been reported, so
+// they fail the check silently.
+func (parser *Parser) CheckType(value types.Type, checked types.Type, msg string) bool {
+	if types.IsInvalid(value) || types.IsInvalid(checked) {
+		return true
+	}
+
+	if !types.Identical(value, checked) {
 		parser.listing.AddSemanticError(msg)
 		return true
 	} else {
@@ -175,12 +304,66 @@ func (parser *Parser) CheckType(value AttributeType, checked AttributeType, msg
 	}
 }
 
-func (parser *Parser) program() {
+// CheckAssignable reports a semantic error and returns true when a value
+// of type value cannot be assigned to something of type target.
+func (parser *Parser) CheckAssignable(value types.Type, target types.Type, msg string) bool {
+	if types.IsInvalid(value) || types.IsInvalid(target) {
+		return true
+	}
+
+	if !types.AssignableTo(value, target) {
+		parser.listing.AddSemanticError(msg)
+		return true
+	} else {
+		return false
+	}
+}
+
+// CheckNumeric reports a semantic error and returns true when value is
+// neither an integer nor a real.
+func (parser *Parser) CheckNumeric(value types.Type, msg string) bool {
+	if types.IsInvalid(value) {
+		return true
+	}
+
+	if !types.IsNumeric(value) {
+		parser.listing.AddSemanticError(msg)
+		return true
+	} else {
+		return false
+	}
+}
+
+// numType returns the type of a NUM token.
+func numType(num Token) types.Type {
+	switch num.Attr() {
+	case INT:
+		return types.Integer
+	case REAL, LONG_REAL:
+		return types.Real
+	}
+	return types.Invalid
+}
+
+// compilation_unit parses a source file, which is either a program or a
+// unit.
+func (parser *Parser) compilation_unit() {
 	parser.nextTok()
+
+	if parser.accept(UNIT) {
+		parser.unit()
+	} else {
+		parser.program()
+	}
+}
+
+func (parser *Parser) program() {
 	parser.expect(PROG)
+	line := parser.currentLine()
 	programName := parser.expect(ID)
 
-	newSymbol := NewSymbol(programName.Value(), PGNAME)
+	newSymbol := NewSymbol(programName.Value(), ProgramSym, nil)
+	newSymbol.SetLine(line)
 	parser.scanner.SymbolTable().AddSymbol(newSymbol)
 	parser.scope.CreateRoot(programName.Value(), newSymbol)
 
@@ -189,25 +372,285 @@ func (parser *Parser) program() {
 	parser.expect(RIGHT_PAREN)
 	parser.expect(SEMI)
 
+	if parser.accept(USES) {
+		parser.uses_clause()
+	}
+
 	parser.program_prime()
 
+	parser.checkForwards(parser.scope.GetTop())
+	parser.scope.Pop()
+}
+
+// unit parses a unit. Everything declared in the interface section is
+// exported; the procedures it declares are defined in the implementation
+// section.
+func (parser *Parser) unit() {
+	parser.expect(UNIT)
+	line := parser.currentLine()
+	unitName := parser.expect(ID)
+
+	newSymbol := NewSymbol(unitName.Value(), UnitSym, nil)
+	newSymbol.SetLine(line)
+	parser.scanner.SymbolTable().AddSymbol(newSymbol)
+	parser.scope.CreateRoot(unitName.Value(), newSymbol)
+
+	parser.expect(SEMI)
+	parser.expect(INTERFACE)
+
+	if parser.accept(USES) {
+		parser.uses_clause()
+	}
+
+	parser.interface_part()
+
+	root := parser.scope.GetRoot()
+	vars := len(root.GetVars())
+	parser.interfaces = len(root.GetChildren())
+
+	parser.expect(IMPLEMENTATION)
+	parser.implementation_part()
+
+	parser.checkForwards(parser.scope.GetTop())
 	parser.scope.Pop()
+
+	parser.exports = NewUnitFile(root, vars, parser.interfaces, parser.uses, parser.units)
+
+	parser.exported = make(map[*Symbol]bool)
+	for _, blueNode := range root.GetVars()[:vars] {
+		parser.exported[blueNode.GetSymbol()] = true
+	}
+	for _, greenNode := range root.GetChildren()[:parser.interfaces] {
+		parser.exported[greenNode.GetSymbol()] = true
+	}
+}
+
+func (parser *Parser) interface_part() {
+	if parser.accept(TYPE) {
+		parser.type_declarations()
+	}
+
+	if parser.accept(VAR) {
+		parser.declarations()
+	}
+
+	parser.procedure_headings()
+}
+
+// procedure_headings parses the procedure headings of an interface
+// section. They are treated like forward declarations.
+func (parser *Parser) procedure_headings() {
+	if parser.accept(PROC) {
+		parser.subprogram_head()
+		parser.scope.GetTop().SetForward(true)
+		parser.scope.Pop()
+
+		parser.procedure_headings()
+	} else if parser.accept(IMPLEMENTATION) {
+		// NOOP
+	} else {
+		// ERROR
+		parser.printError("procedure", "implementation")
+		parser.sync(IMPLEMENTATION)
+	}
+}
+
+func (parser *Parser) implementation_part() {
+	if parser.accept(TYPE) {
+		parser.type_declarations()
+	}
+
+	if parser.accept(VAR) {
+		parser.declarations()
+	}
+
+	if parser.accept(PROC) {
+		parser.subprogram_declarations()
+	}
+
+	if parser.accept(BEGIN) {
+		parser.body(parser.compound_statement())
+	} else {
+		parser.expect(END_DEC)
+	}
+
+	parser.expect(END)
+}
+
+func (parser *Parser) uses_clause() {
+	parser.expect(USES)
+	parser.unit_list()
+	parser.expect(SEMI)
+}
+
+func (parser *Parser) unit_list() {
+	id := parser.expect(ID)
+	parser.importUnit(id.Value())
+
+	if parser.accept(COMMA) {
+		parser.expect(COMMA)
+		parser.unit_list()
+	}
+}
+
+// importUnit makes the symbols exported by a unit visible in the root
+// scope.
+func (parser *Parser) importUnit(name string) {
+	if parser.scope.IsImported(name) {
+		parser.listing.AddSemanticError("Unit " + name + " is already used")
+		return
+	}
+
+	unit, err := parser.loadUnit(name)
+	if err != nil {
+		parser.listing.AddSemanticError(err.Error())
+		return
+	}
+
+	parser.uses = append(parser.uses, name)
+	parser.scope.Import(unit)
+}
+
+// loadUnit returns the exported symbols of a unit. They are read from
+// the unit file next to the source file. The unit is compiled again
+// first if its source exists and its interface section no longer
+// matches the unit file; changes to the implementation section alone do
+// not rebuild it, so errors in them are only found by compiling the
+// unit itself.
+func (parser *Parser) loadUnit(name string) (*GreenNode, error) {
+	if unit, ok := parser.units[name]; ok {
+		if unit == nil {
+			return nil, fmt.Errorf("Circular use of unit %s", name)
+		}
+		return unit, nil
+	}
+
+	source := filepath.Join(filepath.Dir(parser.file), name+".pas")
+	symFile := unitFileName(parser.file, name)
+
+	unitFile, loadErr := LoadUnitFile(symFile)
+	if _, err := os.Stat(source); err == nil {
+		hash := parser.interfaceHash(source)
+		if loadErr != nil || unitFile.Interface != hash {
+			unitFile, loadErr = parser.buildUnit(name, source)
+		}
+	} else if loadErr != nil {
+		return nil, fmt.Errorf("Unit %s not found", name)
+	}
+
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	parser.units[name] = nil
+	for _, used := range unitFile.Uses {
+		if _, err := parser.loadUnit(used); err != nil {
+			delete(parser.units, name)
+			return nil, err
+		}
+	}
+
+	unit, err := unitFile.Scope(parser.units)
+	if err != nil {
+		delete(parser.units, name)
+		return nil, err
+	}
+	parser.units[name] = unit
+	return unit, nil
+}
+
+// buildUnit compiles the source of a unit and writes its unit file. The
+// unit's listing is not saved; compile the unit on its own to see its
+// errors.
+func (parser *Parser) buildUnit(name string, source string) (*UnitFile, error) {
+	parser.units[name] = nil
+	defer delete(parser.units, name)
+
+	unitParser := NewParser(parser.scanner.Fork())
+	unitParser.dialect = parser.dialect
+	unitParser.scanner.ReadSourceFile(source)
+	unitParser.listing = NewListingFile()
+	unitParser.memory = NewMemoryOffsetList()
+	unitParser.source = ReadFile(source)
+	unitParser.file = source
+	unitParser.scope = NewScopeTree()
+	unitParser.units = parser.units
+
+	unitParser.compilation_unit()
+
+	if unitParser.exports == nil || unitParser.exports.Name != name {
+		return nil, fmt.Errorf("%s is not the source of unit %s", source, name)
+	}
+
+	if unitParser.listing.ErrorCount() > 0 {
+		return nil, fmt.Errorf("Unit %s contains errors", name)
+	}
+
+	unitParser.exports.Interface = parser.interfaceHash(source)
+	if err := unitParser.exports.Save(unitFileName(source, name)); err != nil {
+		return nil, err
+	}
+
+	return unitParser.exports, nil
+}
+
+// interfaceHash returns a hash of the tokens in the interface section of
+// a unit's source. Comments, layout and the implementation section do
+// not affect it.
+func (parser *Parser) interfaceHash(source string) string {
+	scanner := parser.scanner.Fork()
+	scanner.ReadSourceFile(source)
+
+	hash := sha256.New()
+	inInterface := false
+
+	for {
+		tok, err := scanner.NextToken()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+
+		if tok.Type() == EOF || tok.Attr() == IMPLEMENTATION {
+			break
+		}
+
+		if tok.Attr() == INTERFACE {
+			inInterface = true
+		} else if inInterface && tok.Type() != WS {
+			io.WriteString(hash, tok.Value()+"\n")
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// unitFileName returns the name of the unit file for a unit whose
+// source is next to file.
+func unitFileName(file string, name string) string {
+	return filepath.Join(filepath.Dir(file), name+".sym")
 }
 
 func (parser *Parser) program_prime() {
+	if parser.accept(TYPE) {
+		parser.type_declarations()
+	}
+
 	if parser.accept(VAR) {
 		parser.declarations()
 		parser.program_double_prime()
 	} else if parser.accept(PROC) {
 		parser.subprogram_declarations()
-		parser.compound_statement()
+		parser.body(parser.compound_statement())
 		parser.expect(END)
 	} else if parser.accept(BEGIN) {
-		parser.compound_statement()
+		parser.body(parser.compound_statement())
 		parser.expect(END)
 	} else {
 		// ERROR
-		parser.printError("var", "procedure", "begin")
+		parser.printError("type", "var", "procedure", "begin")
 		parser.sync(EOF)
 	}
 }
@@ -215,10 +658,10 @@ func (parser *Parser) program_prime() {
 func (parser *Parser) program_double_prime() {
 	if parser.accept(PROC) {
 		parser.subprogram_declarations()
-		parser.compound_statement()
+		parser.body(parser.compound_statement())
 		parser.expect(END)
 	} else if parser.accept(BEGIN) {
-		parser.compound_statement()
+		parser.body(parser.compound_statement())
 		parser.expect(END)
 	} else {
 		// ERROR
@@ -228,11 +671,12 @@ func (parser *Parser) program_double_prime() {
 }
 
 func (parser *Parser) identifier_list() {
+	line := parser.currentLine()
 	progParm := parser.expect(ID)
 
-	symbol := NewSymbol(progParm.Value(), PGPARM)
-	parser.scanner.SymbolTable().AddSymbol(symbol)
-	parser.scope.GetTop().AddBlueNode(progParm.Value(), symbol, 0)
+	symbol := NewSymbol(progParm.Value(), ProgramParamSym, nil)
+	symbol.SetLine(line)
+	parser.declare(symbol, 0)
 
 	parser.identifier_list_prime()
 }
@@ -241,10 +685,11 @@ func (parser *Parser) identifier_list_prime() {
 	if parser.accept(COMMA) {
 		parser.expect(COMMA)
 
+		line := parser.currentLine()
 		progParm := parser.expect(ID)
-		symbol := NewSymbol(progParm.Value(), PGPARM)
-		parser.scanner.SymbolTable().AddSymbol(symbol)
-		parser.scope.GetTop().AddBlueNode(progParm.Value(), symbol, 0)
+		symbol := NewSymbol(progParm.Value(), ProgramParamSym, nil)
+		symbol.SetLine(line)
+		parser.declare(symbol, 0)
 
 		parser.identifier_list_prime()
 	} else if parser.accept(RIGHT_PAREN) {
@@ -256,18 +701,44 @@ func (parser *Parser) identifier_list_prime() {
 	}
 }
 
+// declare adds symbol to the scope on top of the stack and to the
+// symbol table. A name can be declared only once in a scope, whatever it
+// is declared as, but may shadow a name declared in an enclosing scope.
+func (parser *Parser) declare(symbol *Symbol, size int) {
+	scope := parser.scope.GetTop()
+	if prev := scope.Declared(symbol.GetName()); prev != nil {
+		parser.redeclared(symbol, prev)
+		return
+	}
+
+	scope.AddBlueNode(symbol.GetName(), symbol, size)
+	parser.scanner.SymbolTable().AddSymbol(symbol)
+}
+
+// redeclared reports that symbol reuses the name of prev, which is
+// declared in the same scope.
+func (parser *Parser) redeclared(symbol *Symbol, prev *Symbol) {
+	kind := symbol.GetKind().String()
+	msg := strings.ToUpper(kind[:1]) + kind[1:] + " " + symbol.GetName() + " already declared"
+	if prev.GetKind() != symbol.GetKind() {
+		msg += " as a " + prev.GetKind().String()
+	}
+	msg += " on line " + strconv.Itoa(prev.GetLine())
+
+	parser.listing.AddSemanticError(msg)
+}
+
 func (parser *Parser) declarations() {
 	parser.expect(VAR)
+	line := parser.currentLine()
 	id := parser.expect(ID)
 	parser.expect(COLON)
 
-	typeName, length := parser.type_prod(id.Value())
-	symbol := NewSymbol(id.Value(), typeName)
-	parser.scanner.SymbolTable().AddSymbol(symbol)
-	err := parser.scope.GetTop().AddBlueNode(id.Value(), symbol, length)
-	if err != nil {
-		parser.listing.AddSemanticError("Variable " + id.Value() + " already declared")
-	}
+	typeName := parser.checkOpenArray(parser.type_prod(id.Value()))
+	parser.resolvePointers()
+	symbol := NewSymbol(id.Value(), VariableSym, typeName)
+	symbol.SetLine(line)
+	parser.declare(symbol, typeName.Size())
 
 	parser.expect(SEMI)
 	parser.declarations_prime()
@@ -276,166 +747,515 @@ func (parser *Parser) declarations() {
 func (parser *Parser) declarations_prime() {
 	if parser.accept(VAR) {
 		parser.expect(VAR)
+		line := parser.currentLine()
 		id := parser.expect(ID)
 		parser.expect(COLON)
 
-		typeName, length := parser.type_prod(id.Value())
-		symbol := NewSymbol(id.Value(), typeName)
-		parser.scanner.SymbolTable().AddSymbol(symbol)
-		err := parser.scope.GetTop().AddBlueNode(id.Value(), symbol, length)
-		if err != nil {
-			parser.listing.AddSemanticError("Variable " + id.Value() + " already declared")
-		}
+		typeName := parser.checkOpenArray(parser.type_prod(id.Value()))
+		parser.resolvePointers()
+		symbol := NewSymbol(id.Value(), VariableSym, typeName)
+		symbol.SetLine(line)
+		parser.declare(symbol, typeName.Size())
 
 		parser.expect(SEMI)
 		parser.declarations_prime()
-	} else if parser.accept(PROC | BEGIN) {
+	} else if parser.accept(PROC | BEGIN | END_DEC | IMPLEMENTATION) {
 		// NOOP
 	} else {
 		// ERROR
-		parser.printError("var", "procedure", "begin")
-		parser.sync(PROC | BEGIN)
+		parser.printError("var", "procedure", "begin", "end", "implementation")
+		parser.sync(PROC | BEGIN | END_DEC | IMPLEMENTATION)
 	}
 }
 
-func (parser *Parser) type_prod(id string) (AttributeType, int) {
-	if parser.accept(INT_DEC | REAL_DEC) {
-		standardType := parser.standard_type(id)
-		var size int
-		switch standardType {
-		case INT:
-			size = 4
-		case REAL:
-			size = 8
-		}
-		return standardType, size
-	} else if parser.accept(ARRAY) {
-		parser.expect(ARRAY)
-		parser.expect(LEFT_BRACKET)
-
-		num1 := parser.expect(NUM)
-		if parser.CheckType(num1.Attr(), INT, "Array index type mismatch") {
-			return ERR, 0
-		}
-
-		parser.expect(RANGE)
-
-		num2 := parser.expect(NUM)
-		if parser.CheckType(num2.Attr(), INT, "Array index type mismatch") {
-			return ERR, 0
-		}
-
-		num1Val, _ := strconv.Atoi(num1.Value())
-		num2Val, _ := strconv.Atoi(num2.Value())
-
-		length := num2Val - num1Val + 1
-
-		parser.expect(RIGHT_BRACKET)
-		parser.expect(OF)
-
-		standard_type := parser.standard_type(id)
+func (parser *Parser) type_declarations() {
+	parser.expect(TYPE)
+	parser.type_definition()
+	parser.type_declarations_prime()
+	parser.resolvePointers()
+}
 
-		if standard_type == PPINT {
-			return PPAINT, 0
-		} else if standard_type == PPREAL {
-			return PPAREAL, 0
-		} else if standard_type == INT {
-			return AINT, 4 * length
-		} else if standard_type == REAL {
-			return AREAL, 8 * length
-		} else {
-			return ERR, 0
-		}
+func (parser *Parser) type_declarations_prime() {
+	if parser.accept(ID) {
+		parser.type_definition()
+		parser.type_declarations_prime()
+	} else if parser.accept(VAR | PROC | BEGIN | END_DEC | IMPLEMENTATION) {
+		// NOOP
 	} else {
 		// ERROR
-		parser.printError("integer", "real", "array")
-		parser.sync(ARRAY)
-		return ERR, 0
+		parser.printError("an identifier", "var", "procedure", "begin", "end", "implementation")
+		parser.sync(VAR | PROC | BEGIN | END_DEC | IMPLEMENTATION)
 	}
 }
 
-func (parser *Parser) standard_type(id string) AttributeType {
-	if parser.accept(INT_DEC) {
-		parser.expect(INT_DEC)
-		return INT
-	} else if parser.accept(REAL_DEC) {
-		parser.expect(REAL_DEC)
-		return REAL
-	} else {
-		// ERROR
-		parser.printError("integer", "real")
-		parser.sync(REAL_DEC)
-		return ERR
+func (parser *Parser) type_definition() {
+	line := parser.currentLine()
+	id := parser.expect(ID)
+	parser.expect(EQ)
+
+	typeName := parser.checkOpenArray(parser.type_prod(id.Value()))
+	switch named := typeName.(type) {
+	case *types.Enum:
+		named.Name = id.Value()
+	case *types.Subrange:
+		named.Name = id.Value()
 	}
-}
 
-func (parser *Parser) subprogram_declarations() {
-	parser.subprogram_declaration()
+	symbol := NewSymbol(id.Value(), TypeSym, typeName)
+	symbol.SetLine(line)
+	parser.declare(symbol, 0)
+
 	parser.expect(SEMI)
-	parser.subprogram_declarations_prime()
 }
 
-func (parser *Parser) subprogram_declarations_prime() {
-	if parser.accept(PROC) {
-		parser.subprogram_declaration()
-		parser.expect(SEMI)
-		parser.subprogram_declarations_prime()
-	} else if parser.accept(BEGIN) {
-		// NOOP
+func (parser *Parser) type_prod(id string) types.Type {
+	if parser.accept(INT_DEC | REAL_DEC) {
+		return parser.standard_type(id)
+	} else if parser.accept(ARRAY) {
+		return parser.array_type(id)
+	} else if parser.accept(RECORD) {
+		return parser.record_type(id)
+	} else if parser.accept(LEFT_PAREN) {
+		return parser.enum_type(id)
+	} else if parser.accept(CARET) {
+		return parser.pointer_type(id)
+	} else if parser.accept(SET) {
+		return parser.set_type(id)
+	} else if parser.accept(ID) {
+		return parser.type_identifier(id)
+	} else if parser.accept(NUM) || parser.accept(ADD) || parser.accept(SUB) {
+		return parser.subrange_type(id)
 	} else {
 		// ERROR
-		parser.printError("procedure", "begin")
-		parser.sync(BEGIN)
+		parser.printError("integer", "real", "array", "record", "set", "(", "^", "a type name", "a constant")
+		parser.sync(ARRAY | RECORD)
+		return types.Invalid
 	}
 }
 
-func (parser *Parser) subprogram_declaration() {
-	parser.subprogram_head()
-	parser.subprogram_declaration_prime()
-	parser.scope.Pop()
+// type_identifier parses a type given by name. An enumerator in the same
+// position starts a subrange such as red .. green.
+func (parser *Parser) type_identifier(id string) types.Type {
+	blueNode, err := parser.scope.GetTop().FindBlueNode(parser.tok.Value())
+	if err == nil && blueNode.GetSymbol().GetKind() == ConstantSym {
+		return parser.subrange_type(id)
+	}
+
+	line := parser.currentLine()
+	name := parser.expect(ID)
+	if typeName, ok := builtinTypes[name.Value()]; ok && err != nil {
+		return typeName
+	}
+	if err != nil || blueNode.GetSymbol().GetKind() != TypeSym {
+		parser.listing.AddSemanticError(name.Value() + " is not a type")
+		return types.Invalid
+	}
+
+	blueNode.GetSymbol().AddRead(line)
+	return blueNode.GetSymbol().GetType()
+}
+
+// builtinTypes are the predeclared types that are not reserved words.
+// A declaration with the same name hides the built-in type.
+var builtinTypes map[string]types.Type = map[string]types.Type{
+	"boolean": types.Boolean,
+}
+
+// array_type parses an array with one or more index types. An array
+// with several index types is an array of arrays, one dimension per
+// index type.
+func (parser *Parser) array_type(id string) types.Type {
+	parser.expect(ARRAY)
+
+	if parser.accept(OF) {
+		parser.expect(OF)
+		elemType := parser.checkOpenArray(parser.type_prod(id))
+		if types.IsInvalid(elemType) {
+			return types.Invalid
+		}
+		return types.NewOpenArray(elemType)
+	}
+
+	parser.expect(LEFT_BRACKET)
+
+	indexes := parser.index_types(make([]*types.Subrange, 0))
+
+	parser.expect(RIGHT_BRACKET)
+	parser.expect(OF)
+
+	elemType := parser.checkOpenArray(parser.type_prod(id))
+	if types.IsInvalid(elemType) {
+		return types.Invalid
+	}
+
+	for i := len(indexes) - 1; i >= 0; i-- {
+		if indexes[i] == nil {
+			return types.Invalid
+		}
+		elemType = types.NewArray(indexes[i].Low, indexes[i].High, indexes[i].Base, elemType)
+	}
+
+	return elemType
+}
+
+// checkOpenArray reports an open array type used anywhere other than
+// as the type of a parameter.
+func (parser *Parser) checkOpenArray(typeName types.Type) types.Type {
+	if _, ok := typeName.(*types.OpenArray); ok {
+		parser.listing.AddSemanticError("Open arrays are only allowed as parameter types")
+		return types.Invalid
+	}
+	return typeName
+}
+
+// index_types parses a comma separated list of array index types. Each
+// index type is returned as a subrange, or nil if it is not valid.
+func (parser *Parser) index_types(indexes []*types.Subrange) []*types.Subrange {
+	var index *types.Subrange
+
+	switch typeName := parser.type_prod("").(type) {
+	case *types.Subrange:
+		index = typeName
+	case *types.Enum:
+		index = types.NewSubrange(0, len(typeName.Names)-1, typeName)
+	default:
+		if !types.IsInvalid(typeName) {
+			parser.listing.AddSemanticError("Array index type must be a subrange or enumerated type, not " + typeName.String())
+		}
+	}
+
+	indexes = append(indexes, index)
+
+	if parser.accept(COMMA) {
+		parser.expect(COMMA)
+		return parser.index_types(indexes)
+	}
+
+	return indexes
+}
+
+// subrange_type parses "low .. high" where both bounds are constants of
+// the same ordinal type.
+func (parser *Parser) subrange_type(id string) types.Type {
+	low, lowType := parser.constant()
+	parser.expect(RANGE)
+	high, highType := parser.constant()
+
+	if types.IsInvalid(lowType) || types.IsInvalid(highType) {
+		return types.Invalid
+	}
+
+	if !types.IsOrdinal(lowType) || !types.Identical(types.Base(lowType), types.Base(highType)) {
+		parser.listing.AddSemanticError("Bounds of a subrange must be constants of the same ordinal type")
+		return types.Invalid
+	}
+
+	base := types.Base(lowType)
+	if low > high {
+		parser.listing.AddSemanticError("Lower bound " + types.OrdinalString(base, low) + " is greater than upper bound " + types.OrdinalString(base, high))
+		return types.Invalid
+	}
+
+	return types.NewSubrange(low, high, base)
+}
+
+// set_type parses "set of T". T must be an ordinal type whose values
+// all fit in a set.
+func (parser *Parser) set_type(id string) types.Type {
+	parser.expect(SET)
+	parser.expect(OF)
+
+	elem := parser.type_prod(id)
+	if types.IsInvalid(elem) {
+		return types.Invalid
+	}
+
+	low, high, ok := types.Bounds(elem)
+	if !types.IsOrdinal(elem) || !ok || low < 0 || high > types.MaxSetElem {
+		parser.listing.AddSemanticError("Set base type must be an ordinal type with values in 0.." + strconv.Itoa(types.MaxSetElem) + ", not " + elem.String())
+		return types.Invalid
+	}
+
+	return types.NewSet(elem)
+}
+
+// pendingPointer is a pointer whose base type had not been declared yet
+// when the pointer type was parsed.
+type pendingPointer struct {
+	pointer *types.Pointer
+	name    string
+	line    int
+}
+
+// pointer_type parses "^ T". Within a type section T may be declared
+// after the pointer type, which is how recursive records are built.
+func (parser *Parser) pointer_type(id string) types.Type {
+	parser.expect(CARET)
+	if parser.accept(INT_DEC | REAL_DEC) {
+		elem := parser.standard_type(id)
+		return types.NewPointer(elem.String(), elem)
+	}
+
+	line := parser.currentLine()
+	name := parser.expect(ID)
+
+	blueNode, err := parser.scope.GetTop().FindBlueNode(name.Value())
+	if err != nil {
+		pointer := types.NewPointer(name.Value(), nil)
+		parser.pointers = append(parser.pointers, &pendingPointer{pointer, name.Value(), line})
+		return pointer
+	}
+
+	if blueNode.GetSymbol().GetKind() != TypeSym {
+		parser.listing.AddSemanticError(name.Value() + " is not a type")
+		return types.Invalid
+	}
+
+	blueNode.GetSymbol().AddRead(line)
+	return types.NewPointer(name.Value(), blueNode.GetSymbol().GetType())
+}
+
+// resolvePointers sets the base types of pointers declared ahead of
+// their base type. It runs at the end of a type section, and after every
+// other type so that an undeclared base type is reported straight away.
+func (parser *Parser) resolvePointers() {
+	for _, pending := range parser.pointers {
+		blueNode, err := parser.scope.GetTop().FindBlueNode(pending.name)
+		if typeName, ok := builtinTypes[pending.name]; ok && err != nil {
+			pending.pointer.Elem = typeName
+			continue
+		}
+		if err != nil || blueNode.GetSymbol().GetKind() != TypeSym {
+			line := strconv.Itoa(pending.line)
+			parser.listing.AddSemanticError("Type " + pending.name + " used by a pointer on line " + line + " is never declared")
+			pending.pointer.Elem = types.Invalid
+			continue
+		}
+
+		blueNode.GetSymbol().AddRead(pending.line)
+		pending.pointer.Elem = blueNode.GetSymbol().GetType()
+	}
+
+	parser.pointers = nil
+}
+
+// enum_type parses a parenthesised list of enumerators. Each enumerator
+// is declared as a constant in the current scope.
+func (parser *Parser) enum_type(id string) types.Type {
+	parser.expect(LEFT_PAREN)
+
+	enum := types.NewEnum()
+	parser.enumerator_list(enum)
+
+	parser.expect(RIGHT_PAREN)
+	return enum
+}
+
+func (parser *Parser) enumerator_list(enum *types.Enum) {
+	line := parser.currentLine()
+	id := parser.expect(ID)
+
+	symbol := NewSymbol(id.Value(), ConstantSym, enum)
+	symbol.SetLine(line)
+	symbol.SetValue(enum.AddName(id.Value()))
+	parser.declare(symbol, 0)
+
+	if parser.accept(COMMA) {
+		parser.expect(COMMA)
+		parser.enumerator_list(enum)
+	}
+}
+
+func (parser *Parser) record_type(id string) types.Type {
+	parser.expect(RECORD)
+
+	record := types.NewRecord()
+	parser.field_list(record)
+
+	parser.expect(END_DEC)
+	return record
+}
+
+func (parser *Parser) field_list(record *types.Record) {
+	field := parser.expect(ID)
+	parser.expect(COLON)
+
+	typeName := parser.checkOpenArray(parser.type_prod(field.Value()))
+	if !record.AddField(field.Value(), typeName) {
+		parser.listing.AddSemanticError("Field " + field.Value() + " already declared")
+	}
+
+	parser.field_list_prime(record)
+}
+
+func (parser *Parser) field_list_prime(record *types.Record) {
+	if parser.accept(SEMI) {
+		parser.expect(SEMI)
+
+		if parser.accept(END_DEC) {
+			// NOOP
+			return
+		}
+
+		parser.field_list(record)
+	} else if parser.accept(END_DEC) {
+		// NOOP
+	} else {
+		// ERROR
+		parser.printError(";", "end")
+		parser.sync(END_DEC)
+	}
+}
+
+func (parser *Parser) standard_type(id string) types.Type {
+	if parser.accept(INT_DEC) {
+		parser.expect(INT_DEC)
+		return types.Integer
+	} else if parser.accept(REAL_DEC) {
+		parser.expect(REAL_DEC)
+		return types.Real
+	} else {
+		// ERROR
+		parser.printError("integer", "real")
+		parser.sync(REAL_DEC)
+		return types.Invalid
+	}
+}
+
+func (parser *Parser) subprogram_declarations() {
+	parser.subprogram_declaration()
+	parser.expect(SEMI)
+	parser.subprogram_declarations_prime()
+}
+
+func (parser *Parser) subprogram_declarations_prime() {
+	if parser.accept(PROC) {
+		parser.subprogram_declaration()
+		parser.expect(SEMI)
+		parser.subprogram_declarations_prime()
+	} else if parser.accept(BEGIN | END_DEC) {
+		// NOOP
+	} else {
+		// ERROR
+		parser.printError("procedure", "begin", "end")
+		parser.sync(BEGIN | END_DEC)
+	}
+}
+
+func (parser *Parser) subprogram_declaration() {
+	parser.subprogram_head()
+
+	if parser.accept(ID) && parser.tok.Value() == "forward" {
+		parser.expect(ID)
+		parser.scope.GetTop().SetForward(true)
+	} else {
+		parser.subprogram_declaration_prime()
+		parser.checkForwards(parser.scope.GetTop())
+	}
+
+	parser.scope.Pop()
+}
+
+// checkForwards reports procedures declared forward in node's scope
+// whose full declaration never appeared. The procedures declared in the
+// interface of a unit come first in the unit's scope.
+func (parser *Parser) checkForwards(node *GreenNode) {
+	for i, child := range node.GetChildren() {
+		if child.IsForward() {
+			line := strconv.Itoa(child.GetSymbol().GetLine())
+			if node == parser.scope.GetRoot() && i < parser.interfaces {
+				parser.listing.AddSemanticError("Procedure " + child.GetName() + " declared in the interface on line " + line + " is never defined")
+			} else {
+				parser.listing.AddSemanticError("Procedure " + child.GetName() + " declared forward on line " + line + " is never defined")
+			}
+		}
+	}
 }
 
 func (parser *Parser) subprogram_declaration_prime() {
+	if parser.accept(TYPE) {
+		parser.type_declarations()
+	}
+
 	if parser.accept(VAR) {
 		parser.declarations()
 		parser.subprogram_declaration_double_prime()
 	} else if parser.accept(BEGIN) {
-		parser.compound_statement()
+		parser.body(parser.compound_statement())
 	} else if parser.accept(PROC) {
 		parser.subprogram_declarations()
+		parser.body(parser.compound_statement())
 	} else {
 		// ERROR
-		parser.printError("var", "begin", "procedure")
+		parser.printError("type", "var", "begin", "procedure")
 		parser.sync(BEGIN | PROC)
 	}
 }
 
 func (parser *Parser) subprogram_declaration_double_prime() {
 	if parser.accept(BEGIN) {
-		parser.compound_statement()
+		parser.body(parser.compound_statement())
 	} else if parser.accept(PROC) {
 		parser.subprogram_declarations()
-		parser.compound_statement()
+		parser.body(parser.compound_statement())
 	}
 }
 
 func (parser *Parser) subprogram_head() {
 	parser.expect(PROC)
 
+	line := parser.currentLine()
 	procName := parser.expect(ID)
-	greenNode := parser.scope.GetTop().FindGreenNode(procName.Value())
+	greenNode := parser.scope.GetTop().FindLocalGreenNode(procName.Value())
 
-	if greenNode != nil {
-		parser.listing.AddSemanticError("Procedure " + procName.Value() + " already exists")
+	if greenNode != nil && greenNode.IsForward() {
+		parser.forward_head(greenNode)
+		return
 	}
 
-	symbol := NewSymbol(procName.Value(), PROC)
-	parser.scanner.SymbolTable().AddSymbol(symbol)
+	symbol := NewSymbol(procName.Value(), ProcedureSym, types.NewProcedure())
+	symbol.SetLine(line)
+
+	if prev := parser.scope.GetTop().Declared(procName.Value()); prev != nil {
+		parser.redeclared(symbol, prev)
+	} else {
+		parser.scanner.SymbolTable().AddSymbol(symbol)
+	}
 	parser.scope.AddGreenNode(procName.Value(), symbol)
 
 	parser.subprogram_head_prime()
 }
 
+// forward_head parses the heading of the full declaration of a procedure
+// that was declared forward. The parameter list may be left out, in which
+// case the parameters of the forward declaration are used.
+func (parser *Parser) forward_head(greenNode *GreenNode) {
+	forwardVars, forwardType := greenNode.ClearParams()
+	greenNode.SetForward(false)
+	parser.scope.Reopen(greenNode)
+
+	// The parameters of the full declaration replace those of the
+	// forward one, which are listed again when they are left out.
+	for _, blueNode := range forwardVars {
+		parser.scanner.SymbolTable().RemoveSymbol(blueNode.GetSymbol())
+	}
+
+	parser.subprogram_head_prime()
+
+	if greenNode.GetNumParams() == 0 {
+		greenNode.RestoreParams(forwardVars, forwardType)
+		for _, blueNode := range forwardVars {
+			parser.scanner.SymbolTable().AddSymbol(blueNode.GetSymbol())
+		}
+		return
+	}
+
+	if !types.Identical(forwardType, greenNode.GetSymbol().GetType()) {
+		line := strconv.Itoa(greenNode.GetSymbol().GetLine())
+		parser.listing.AddSemanticError("Parameters of procedure " + greenNode.GetName() + " do not match its forward declaration on line " + line)
+	}
+}
+
 func (parser *Parser) subprogram_head_prime() {
 	if parser.accept(LEFT_PAREN) {
 		parser.arguments()
@@ -456,26 +1276,16 @@ func (parser *Parser) arguments() {
 }
 
 func (parser *Parser) parameter_list() {
+	line := parser.currentLine()
 	id := parser.expect(ID)
 	parser.expect(COLON)
-	typeName, length := parser.type_prod(id.Value())
-
-	var symbol *Symbol
-	if typeName == INT {
-		symbol = NewSymbol(id.Value(), PPINT)
-	} else if typeName == REAL {
-		symbol = NewSymbol(id.Value(), PPREAL)
-	} else if typeName == AINT {
-		symbol = NewSymbol(id.Value(), PPAINT)
-	} else if typeName == AREAL {
-		symbol = NewSymbol(id.Value(), PPAREAL)
-	}
-
-	parser.scanner.SymbolTable().AddSymbol(symbol)
+	typeName := parser.type_prod(id.Value())
+	parser.resolvePointers()
 
-	greenNode := parser.scope.GetTop()
-	greenNode.AddBlueNode(id.Value(), symbol, length)
-	greenNode.IncParam()
+	symbol := NewSymbol(id.Value(), ParameterSym, typeName)
+	symbol.SetLine(line)
+	parser.declare(symbol, typeName.Size())
+	parser.scope.GetTop().AddParam(id.Value(), typeName)
 
 	parser.parameter_list_prime()
 }
@@ -483,26 +1293,16 @@ func (parser *Parser) parameter_list() {
 func (parser *Parser) parameter_list_prime() {
 	if parser.accept(SEMI) {
 		parser.expect(SEMI)
+		line := parser.currentLine()
 		id := parser.expect(ID)
 		parser.expect(COLON)
-		typeName, length := parser.type_prod(id.Value())
-
-		var symbol *Symbol
-		if typeName == INT {
-			symbol = NewSymbol(id.Value(), PPINT)
-		} else if typeName == REAL {
-			symbol = NewSymbol(id.Value(), PPREAL)
-		} else if typeName == AINT {
-			symbol = NewSymbol(id.Value(), PPAINT)
-		} else if typeName == AREAL {
-			symbol = NewSymbol(id.Value(), PPAREAL)
-		}
+		typeName := parser.type_prod(id.Value())
+		parser.resolvePointers()
 
-		parser.scanner.SymbolTable().AddSymbol(symbol)
-
-		greenNode := parser.scope.GetTop()
-		greenNode.AddBlueNode(id.Value(), symbol, length)
-		greenNode.IncParam()
+		symbol := NewSymbol(id.Value(), ParameterSym, typeName)
+		symbol.SetLine(line)
+		parser.declare(symbol, typeName.Size())
+		parser.scope.GetTop().AddParam(id.Value(), typeName)
 
 		parser.parameter_list_prime()
 	} else if parser.accept(RIGHT_PAREN) {
@@ -514,448 +1314,972 @@ func (parser *Parser) parameter_list_prime() {
 	}
 }
 
-func (parser *Parser) compound_statement() {
+func (parser *Parser) compound_statement() *ast.Block {
+	line := parser.currentLine()
 	parser.expect(BEGIN)
-	parser.compound_statement_prime()
+	return ast.NewBlock(parser.compound_statement_prime(), line)
 }
 
-func (parser *Parser) compound_statement_prime() {
-	if parser.accept(ID) || parser.accept(CALL|BEGIN|IF|WHILE) {
-		parser.optional_statements()
+// body records the statement part of the procedure or program whose
+// scope is on top of the stack.
+func (parser *Parser) body(block *ast.Block) {
+	parser.bodies = append(parser.bodies, ast.NewBody(parser.scope.GetTop(), block))
+}
+
+func (parser *Parser) compound_statement_prime() []ast.Stmt {
+	if parser.accept(ID) || parser.accept(CALL|BEGIN|IF|WHILE|FOR|REPEAT|CASE) {
+		list := parser.optional_statements()
 		parser.expect(END_DEC)
+		return list
 	} else if parser.accept(END_DEC) {
 		// NOOP
 		parser.expect(END_DEC)
+		return nil
 	} else {
 		// ERROR
-		parser.printError("a identifier", "call", "begin", "if", "while", "end")
+		parser.printError("a identifier", "call", "begin", "if", "while", "for", "repeat", "case", "end")
 		parser.sync(END_DEC)
+		return nil
 	}
 }
 
-func (parser *Parser) optional_statements() {
-	parser.statement_list()
+func (parser *Parser) optional_statements() []ast.Stmt {
+	return parser.statement_list()
 }
 
-func (parser *Parser) statement_list() {
-	parser.statement()
-	parser.statement_list_prime()
+func (parser *Parser) statement_list() []ast.Stmt {
+	statement := parser.statement()
+	return parser.statement_list_prime([]ast.Stmt{statement})
 }
 
-func (parser *Parser) statement_list_prime() {
+func (parser *Parser) statement_list_prime(list []ast.Stmt) []ast.Stmt {
 	if parser.accept(SEMI) {
 		parser.expect(SEMI)
-		parser.statement()
-		parser.statement_list_prime()
-	} else if parser.accept(END_DEC) {
+		statement := parser.statement()
+		return parser.statement_list_prime(append(list, statement))
+	} else if parser.accept(END_DEC | UNTIL) {
 		// NOOP
+		return list
 	} else {
 		// ERROR
-		parser.printError(";", "end")
-		parser.sync(END_DEC)
+		parser.printError(";", "end", "until")
+		parser.sync(END_DEC | UNTIL)
+		return list
 	}
 }
 
-func (parser *Parser) statement() AttributeType {
-	if parser.accept(ID) {
+func (parser *Parser) statement() ast.Stmt {
+	line := parser.currentLine()
+
+	if parser.accept(ID) && parser.isBuiltinProcedure(parser.tok.Value()) {
+		return parser.builtin_procedure(parser.expect(ID), line)
+	} else if parser.accept(ID) && parser.isBranch(parser.tok.Value()) {
+		return parser.branch_statement()
+	} else if parser.accept(ID) && parser.isProcedureCall(parser.tok.Value()) {
+		id := parser.expect(ID)
+		return parser.procedure_call(id, line)
+	} else if parser.accept(ID) {
 		variable := parser.variable()
 		parser.expect(ASSIGNOP)
 		expression := parser.expression()
 
-		switch variable {
-		case PPINT:
-			variable = INT
-		case PPREAL:
-			variable = REAL
-		case PPAINT:
-			variable = AINT
-		case PPAREAL:
-			variable = AREAL
-		}
-
-		if variable == ERR || expression == ERR {
-			return ERR
+		if !parser.CheckAssignable(expression.Type(), variable.Type(), "ASSIGNOP type mismatch") {
+			parser.checkRange(expression, variable.Type())
 		}
 
-		if parser.CheckType(variable, expression, "ASSIGNOP type mismatch") {
-			return ERR
-		}
+		return ast.NewAssign(variable, expression, line)
 	} else if parser.accept(CALL) {
-		parser.procedure_statement()
+		return parser.procedure_statement()
 	} else if parser.accept(BEGIN) {
-		parser.compound_statement()
+		return parser.compound_statement()
 	} else if parser.accept(IF) {
 		parser.expect(IF)
 
 		expression := parser.expression()
-		if expression != ERR {
-			parser.CheckType(expression, BOOL, "Only boolean expressions are allowed in if statements")
-		}
+		parser.CheckType(expression.Type(), types.Boolean, "Only boolean expressions are allowed in if statements")
 
 		parser.expect(THEN)
-		parser.statement()
-		parser.statement_prime()
+		then := parser.statement()
+		els := parser.statement_prime()
+
+		return ast.NewIf(expression, then, els, line)
 	} else if parser.accept(WHILE) {
 		parser.expect(WHILE)
 
 		expression := parser.expression()
-		if expression != ERR {
-			parser.CheckType(expression, BOOL, "Only boolean expressions are allowed in while statements")
+		parser.CheckType(expression.Type(), types.Boolean, "Only boolean expressions are allowed in while statements")
+
+		parser.expect(DO)
+		body := parser.loop_body()
+
+		return ast.NewWhile(expression, body, line)
+	} else if parser.accept(FOR) {
+		// The bounds are evaluated once before the loop starts. A "to" loop
+		// whose initial value is greater than its final value, or a "downto"
+		// loop whose initial value is less, runs its body zero times.
+		parser.expect(FOR)
+		controlLine := parser.currentLine()
+		id := parser.expect(ID)
+
+		var controlVar ast.Expr = ast.NewBad()
+		control := parser.scope.GetTop().FindLocalBlueNode(id.Value())
+		if control == nil || control.GetSymbol().GetKind() != VariableSym {
+			parser.listing.AddSemanticError("For loop control variable " + id.Value() + " must be a variable declared in the current scope")
+		} else if !types.IsInteger(control.GetSymbol().GetType()) {
+			parser.listing.AddSemanticError("For loop control variable " + id.Value() + " must be an integer")
+		} else if parser.isControl(control) {
+			parser.listing.AddSemanticError("For loop control variable " + id.Value() + " is already used by an enclosing loop")
+		} else {
+			sym := control.GetSymbol()
+			sym.AddWrite(controlLine)
+			controlVar = ast.NewIdent(id.Value(), sym, sym.GetType())
 		}
 
+		parser.expect(ASSIGNOP)
+		initial := parser.expression()
+		parser.CheckAssignable(initial.Type(), types.Integer, "Initial value of a for loop must be an integer")
+
+		down := false
+		if parser.accept(TO) {
+			parser.expect(TO)
+		} else {
+			parser.expect(DOWNTO)
+			down = true
+		}
+
+		final := parser.expression()
+		parser.CheckAssignable(final.Type(), types.Integer, "Final value of a for loop must be an integer")
+
 		parser.expect(DO)
-		parser.statement()
+
+		parser.controls = append(parser.controls, control)
+		body := parser.loop_body()
+		parser.controls = parser.controls[:len(parser.controls)-1]
+
+		return ast.NewFor(controlVar, initial, final, down, body, line)
+	} else if parser.accept(REPEAT) {
+		parser.expect(REPEAT)
+
+		// The body may be empty, as in repeat until ready.
+		bodyLine := parser.currentLine()
+		var list []ast.Stmt
+		if !parser.accept(UNTIL) {
+			parser.loops++
+			list = parser.statement_list()
+			parser.loops--
+		}
+
+		parser.expect(UNTIL)
+
+		condLine := parser.currentLine()
+		expression := parser.expression()
+		parser.CheckType(expression.Type(), types.Boolean, "Only boolean expressions are allowed in repeat statements")
+
+		return ast.NewRepeat(ast.NewBlock(list, bodyLine), expression, condLine, line)
+	} else if parser.accept(CASE) {
+		parser.expect(CASE)
+
+		selectorExpr := parser.expression()
+		selector := selectorExpr.Type()
+		if !types.IsInvalid(selector) && !types.IsOrdinal(selector) {
+			parser.listing.AddSemanticError("Case selector must be of an ordinal type, not " + selector.String())
+			selector = types.Invalid
+		}
+
+		parser.expect(OF)
+		clauses := parser.case_element_list(selector, make([]*caseLabel, 0), nil)
+		els := parser.case_else()
+		parser.expect(END_DEC)
+
+		return ast.NewCase(selectorExpr, clauses, els, line)
 	} else {
 		// ERROR
-		parser.printError("an identifier", "call", "begin", "if", "while")
-		parser.sync(CALL | BEGIN | IF | WHILE)
-		return ERR
+		parser.printError("an identifier", "call", "begin", "if", "while", "for", "repeat", "case")
+		parser.sync(CALL | BEGIN | IF | WHILE | FOR | REPEAT | CASE)
+		return ast.NewBadStmt(line)
+	}
+}
+
+// loop_body parses the body of a while or for loop, where break and
+// continue are allowed.
+func (parser *Parser) loop_body() ast.Stmt {
+	parser.loops++
+	body := parser.statement()
+	parser.loops--
+
+	return body
+}
+
+// branches are the predeclared jump statements. A declaration with the
+// same name hides the jump statement.
+var branches map[string]ast.BranchKind = map[string]ast.BranchKind{
+	"break":    ast.Break,
+	"continue": ast.Continue,
+	"exit":     ast.Exit,
+}
+
+func (parser *Parser) isBranch(name string) bool {
+	if _, ok := branches[name]; !ok {
+		return false
 	}
 
-	return NULL
+	blueNode, greenNode := parser.scope.GetTop().Lookup(name)
+	return blueNode == nil && greenNode == nil
+}
+
+// branch_statement parses break, continue or exit. break and continue
+// jump out of or to the next iteration of the innermost loop, so they
+// are rejected outside of a loop; exit returns from the procedure.
+func (parser *Parser) branch_statement() ast.Stmt {
+	line := parser.currentLine()
+	id := parser.expect(ID)
+	kind := branches[id.Value()]
+
+	if kind != ast.Exit && parser.loops == 0 {
+		parser.listing.AddSemanticError(id.Value() + " on line " + strconv.Itoa(line) + " is not inside a while, for or repeat loop")
+	}
+
+	return ast.NewBranch(kind, line)
+}
+
+// caseLabel is a label, or range of labels, already seen in a case
+// statement. It is kept so later labels can be checked for overlaps.
+type caseLabel struct {
+	low  int
+	high int
+	typ  types.Type
+	line int
+}
+
+func (label *caseLabel) String() string {
+	if label.low == label.high {
+		return types.OrdinalString(label.typ, label.low)
+	}
+	return types.OrdinalString(label.typ, label.low) + ".." + types.OrdinalString(label.typ, label.high)
+}
+
+func (parser *Parser) case_element_list(selector types.Type, labels []*caseLabel, clauses []*ast.CaseClause) []*ast.CaseClause {
+	line := parser.currentLine()
+	before := len(labels)
+	labels = parser.case_label_list(selector, labels)
+	parser.expect(COLON)
+	body := parser.statement()
+
+	values := make([][2]int, 0)
+	for _, label := range labels[before:] {
+		values = append(values, [2]int{label.low, label.high})
+	}
+	clauses = append(clauses, ast.NewCaseClause(values, body, line))
+
+	return parser.case_element_list_prime(selector, labels, clauses)
+}
+
+func (parser *Parser) case_element_list_prime(selector types.Type, labels []*caseLabel, clauses []*ast.CaseClause) []*ast.CaseClause {
+	if parser.accept(SEMI) {
+		parser.expect(SEMI)
+
+		if parser.accept(ELSE | END_DEC) {
+			// NOOP
+			return clauses
+		}
+
+		return parser.case_element_list(selector, labels, clauses)
+	} else if parser.accept(ELSE | END_DEC) {
+		// NOOP
+		return clauses
+	} else {
+		// ERROR
+		parser.printError(";", "else", "end")
+		parser.sync(ELSE | END_DEC)
+		return clauses
+	}
+}
+
+func (parser *Parser) case_label_list(selector types.Type, labels []*caseLabel) []*caseLabel {
+	line := parser.currentLine()
+	low, lowType := parser.constant()
+	high, highType := low, lowType
+
+	if parser.accept(RANGE) {
+		parser.expect(RANGE)
+		high, highType = parser.constant()
+	}
+
+	label := &caseLabel{low, high, lowType, line}
+
+	if parser.checkCaseLabel(selector, lowType, label) && parser.checkCaseLabel(selector, highType, label) {
+		if low > high {
+			parser.listing.AddSemanticError("Case label range " + label.String() + " is empty")
+		} else {
+			for _, other := range labels {
+				if label.low <= other.high && other.low <= label.high {
+					parser.listing.AddSemanticError("Case label " + label.String() + " overlaps label " + other.String() + " on line " + strconv.Itoa(other.line))
+					break
+				}
+			}
+			labels = append(labels, label)
+		}
+	}
+
+	if parser.accept(COMMA) {
+		parser.expect(COMMA)
+		return parser.case_label_list(selector, labels)
+	}
+
+	return labels
+}
+
+// checkCaseLabel reports whether a label of type labelType may be used
+// with a case selector of type selector.
+func (parser *Parser) checkCaseLabel(selector types.Type, labelType types.Type, label *caseLabel) bool {
+	if types.IsInvalid(selector) || types.IsInvalid(labelType) {
+		return false
+	}
+
+	if !types.Identical(types.Base(selector), types.Base(labelType)) {
+		parser.listing.AddSemanticError("Case label " + label.String() + " is not a constant of type " + selector.String())
+		return false
+	}
+
+	return true
+}
+
+func (parser *Parser) case_else() *ast.Block {
+	if parser.accept(ELSE) {
+		parser.expect(ELSE)
+		line := parser.currentLine()
+		return ast.NewBlock(parser.statement_list(), line)
+	} else if parser.accept(END_DEC) {
+		// NOOP
+		return nil
+	} else {
+		// ERROR
+		parser.printError("else", "end")
+		parser.sync(END_DEC)
+		return nil
+	}
+}
+
+// constant parses an optionally signed number, or an enumerator, and
+// returns its value and type.
+func (parser *Parser) constant() (int, types.Type) {
+	negative := false
+	if parser.accept(ADD) {
+		parser.expect(ADD)
+	} else if parser.accept(SUB) {
+		parser.expect(SUB)
+		negative = true
+	}
+
+	if parser.accept(NUM) {
+		num := parser.expect(NUM)
+		value, err := strconv.Atoi(num.Value())
+		if err != nil {
+			parser.listing.AddSemanticError("Constant " + num.Value() + " is not an integer")
+			return 0, types.Invalid
+		}
+
+		if negative {
+			value = -value
+		}
+		return value, types.Integer
+	} else if parser.accept(ID) {
+		line := parser.currentLine()
+		id := parser.expect(ID)
+
+		blueNode, err := parser.scope.GetTop().FindBlueNode(id.Value())
+		if err != nil || blueNode.GetSymbol().GetKind() != ConstantSym {
+			parser.listing.AddSemanticError(id.Value() + " is not a constant")
+			return 0, types.Invalid
+		}
+
+		if negative {
+			parser.listing.AddSemanticError("Cannot use a sign on " + id.Value())
+			return 0, types.Invalid
+		}
+
+		sym := blueNode.GetSymbol()
+		sym.AddRead(line)
+		return sym.GetValue().(int), sym.GetType()
+	} else {
+		// ERROR
+		parser.printError("a constant")
+		parser.sync(COLON|COMMA, RANGE)
+		return 0, types.Invalid
+	}
 }
 
-func (parser *Parser) statement_prime() {
+func (parser *Parser) statement_prime() ast.Stmt {
 	if parser.accept(ELSE) {
 		parser.expect(ELSE)
-		parser.statement()
-	} else if parser.accept(END_DEC | SEMI | ELSE) {
+		return parser.statement()
+	} else if parser.accept(END_DEC | SEMI | ELSE | UNTIL) {
 		// NOOP
+		return nil
 	} else {
 		// ERROR
-		parser.printError("end", ";", "else")
+		parser.printError("end", ";", "else", "until")
 		parser.sync(ASSIGNOP)
+		return nil
 	}
 }
 
-func (parser *Parser) variable() AttributeType {
+func (parser *Parser) variable() ast.Expr {
+	line := parser.currentLine()
 	id := parser.expect(ID)
 
 	blueNode, err := parser.scope.GetTop().FindBlueNode(id.Value())
 	if err != nil {
 		parser.listing.AddSemanticError("Could not find variable " + id.Value())
-		return ERR
+		parser.variable_prime(ast.NewBad())
+		return ast.NewBad()
 	}
 
 	sym := blueNode.GetSymbol()
+	if sym.GetKind() != VariableSym && sym.GetKind() != ParameterSym {
+		parser.listing.AddSemanticError("Cannot assign to " + sym.GetKind().String() + " " + id.Value())
+		parser.variable_prime(ast.NewBad())
+		return ast.NewBad()
+	}
+
+	if parser.isControl(blueNode) {
+		parser.listing.AddSemanticError("Cannot assign to for loop control variable " + id.Value())
+	}
+
+	variable_prime := parser.variable_prime(ast.NewIdent(id.Value(), sym, sym.GetType()))
 
-	variable_prime := parser.variable_prime(sym.GetType())
+	// Assigning through a pointer reads the pointer variable.
+	if _, deref := ast.Root(variable_prime); deref {
+		sym.AddRead(line)
+	} else {
+		sym.AddWrite(line)
+	}
 	return variable_prime
 }
 
-func (parser *Parser) variable_prime(id AttributeType) AttributeType {
+// isControl reports whether blueNode is the control variable of a for
+// loop that is currently being parsed.
+func (parser *Parser) isControl(blueNode *BlueNode) bool {
+	for _, control := range parser.controls {
+		if control != nil && control == blueNode {
+			return true
+		}
+	}
+	return false
+}
+
+func (parser *Parser) variable_prime(id ast.Expr) ast.Expr {
 	if parser.accept(LEFT_BRACKET) {
 		parser.expect(LEFT_BRACKET)
-		expression := parser.expression()
+		elem := parser.index_list(id)
 		parser.expect(RIGHT_BRACKET)
 
-		if parser.CheckType(expression, INT, "Only use integers as array indices") {
-			return ERR
-		}
+		return parser.variable_prime(elem)
+	} else if parser.accept(END) {
+		parser.expect(END)
+		field := parser.expect(ID)
 
-		return expression
+		return parser.variable_prime(parser.selectField(id, field))
+	} else if parser.accept(CARET) {
+		parser.expect(CARET)
+
+		return parser.variable_prime(parser.deref(id))
 	} else if parser.accept(ASSIGNOP) {
 		// NOOP
 		return id
 	} else {
 		// ERROR
-		parser.printError("[", ":=")
+		parser.printError("[", ".", "^", ":=")
 		parser.sync(ASSIGNOP)
-		return ERR
+		return ast.NewBad()
 	}
 }
 
-func (parser *Parser) procedure_statement() {
-	parser.expect(CALL)
-	id := parser.expect(ID)
-
-	greenNode := parser.scope.GetTop()
-	calledProc := greenNode.FindGreenNode(id.Value())
+// index_list parses the comma separated subscripts inside one pair of
+// brackets. Each subscript selects one dimension, so a[i, j] is a[i][j].
+func (parser *Parser) index_list(array ast.Expr) ast.Expr {
+	expression := parser.expression()
+	elem := parser.index(array, expression)
 
-	if calledProc == nil {
-		parser.listing.AddSemanticError("Procedure " + id.Value() + " not found")
+	if parser.accept(COMMA) {
+		parser.expect(COMMA)
+		return parser.index_list(elem)
 	}
 
-	parser.procedure_statement_prime(calledProc)
+	return elem
 }
 
-func (parser *Parser) procedure_statement_prime(proc *GreenNode) {
-	if parser.accept(LEFT_PAREN) {
-		parser.expect(LEFT_PAREN)
-		parser.expression_list(proc)
-		parser.expect(RIGHT_PAREN)
-	} else if parser.accept(END_DEC | SEMI | ELSE) {
-		// NOOP
-		params := proc.GetNumParams()
-		if params > 0 {
-			parser.listing.AddSemanticError("Too few parameters for call to " + proc.GetName())
+// index checks a subscript applied to x and returns the selected
+// element.
+func (parser *Parser) index(x ast.Expr, expression ast.Expr) ast.Expr {
+	typeName := x.Type()
+	if types.IsInvalid(typeName) || types.IsInvalid(expression.Type()) {
+		return ast.NewBad()
+	}
+
+	if open, ok := typeName.(*types.OpenArray); ok {
+		if !types.IsInteger(expression.Type()) {
+			parser.listing.AddSemanticError("Only use integers as array indices")
+			return ast.NewBad()
 		}
-	} else {
-		// ERROR
-		parser.printError("(", "end", ";", "else")
-		parser.sync(END_DEC | SEMI | ELSE)
+		if value, ok := ast.IntValue(expression); ok && value < 0 {
+			parser.listing.AddSemanticError("Array index " + strconv.Itoa(value) + " is below 0, the lower bound of an open array")
+		}
+		return ast.NewIndex(x, expression, open.Elem)
+	}
+
+	array, ok := typeName.(*types.Array)
+	if !ok {
+		parser.listing.AddSemanticError("Cannot index a variable of type " + typeName.String())
+		return ast.NewBad()
+	}
+
+	if !types.AssignableTo(expression.Type(), array.Index) {
+		if types.IsInteger(array.Index) {
+			parser.listing.AddSemanticError("Only use integers as array indices")
+		} else {
+			parser.listing.AddSemanticError("Array index must be of type " + array.Index.String())
+		}
+		return ast.NewBad()
 	}
+
+	// An index whose value is known at compile time must lie within
+	// the bounds. Others are left to the range analysis in package flow.
+	if value, ok := ast.IntValue(expression); ok && (value < array.Low || value > array.High) {
+		index := types.OrdinalString(array.Index, value)
+		low := types.OrdinalString(array.Index, array.Low)
+		high := types.OrdinalString(array.Index, array.High)
+		parser.listing.AddSemanticError("Array index " + index + " is out of range " + low + ".." + high)
+	}
+
+	return ast.NewIndex(x, expression, array.Elem)
 }
 
-func (parser *Parser) expression_list(proc *GreenNode) AttributeType {
-	if proc == nil {
-		return ERR
+// selectField checks a field selection applied to x and returns the
+// selected field.
+func (parser *Parser) selectField(x ast.Expr, field Token) ast.Expr {
+	typeName := x.Type()
+	if types.IsInvalid(typeName) {
+		return ast.NewBad()
 	}
 
-	vars := proc.GetVars()
-	count := 0
+	record, ok := typeName.(*types.Record)
+	if !ok {
+		parser.listing.AddSemanticError("Cannot select field " + field.Value() + " of a variable of type " + typeName.String())
+		return ast.NewBad()
+	}
 
-	varType := NULL
-	checkVar := vars[count].GetSymbol().GetType()
+	selected := record.Field(field.Value())
+	if selected == nil {
+		parser.listing.AddSemanticError("Record has no field " + field.Value())
+		return ast.NewBad()
+	}
 
-	expression := parser.expression()
-	expression_list_prime := parser.expression_list_prime(proc, count)
+	return ast.NewSelector(x, field.Value(), selected.Type)
+}
 
-	fmt.Println(expression)
-	fmt.Println(expression_list_prime)
-	fmt.Println()
+// deref checks a dereference of x and returns the variable x points to.
+func (parser *Parser) deref(x ast.Expr) ast.Expr {
+	typeName := x.Type()
+	if types.IsInvalid(typeName) {
+		return ast.NewBad()
+	}
 
-	if expression == ERR {
-		parser.listing.AddSyntaxError("Must have arguments inside parentheses")
-		return ERR
+	pointer, ok := typeName.(*types.Pointer)
+	if !ok {
+		parser.listing.AddSemanticError("Cannot dereference a variable of type " + typeName.String())
+		return ast.NewBad()
 	}
 
-	switch checkVar {
-	case PPINT:
-		varType = INT
-	case PPREAL:
-		varType = REAL
-	case PPAINT:
-		varType = AINT
-	case PPAREAL:
-		varType = AREAL
+	return ast.NewDeref(x, pointer.Elem)
+}
+
+// checkRange reports a constant value that lies outside the bounds of an
+// enumerated or subrange target type.
+func (parser *Parser) checkRange(expression ast.Expr, target types.Type) bool {
+	low, high, ok := types.Bounds(target)
+	if !ok {
+		return false
 	}
 
-	if parser.CheckType(varType, expression, "Types for parameter "+strconv.Itoa(count)+" in call to "+proc.GetName()+" do not match") {
-		return ERR
+	value, ok := ast.IntValue(expression)
+	if !ok {
+		return false
 	}
 
-	if expression == NULL {
-		params := proc.GetNumParams()
-		if params != 0 {
-			parser.listing.AddSemanticError("Too few parameters for call to " + proc.GetName())
-			return ERR
-		}
+	if value < low || value > high {
+		lowStr := types.OrdinalString(target, low)
+		highStr := types.OrdinalString(target, high)
+		parser.listing.AddSemanticError("Value " + types.OrdinalString(target, value) + " is out of range " + lowStr + ".." + highStr)
+		return true
 	}
 
-	if expression_list_prime == NULL {
-		params := proc.GetNumParams()
-		if params > 1 {
-			parser.listing.AddSemanticError("Too few parameters for call to " + proc.GetName())
-			return ERR
-		} else if params < 1 {
-			parser.listing.AddSemanticError("Too many parameters for call to " + proc.GetName())
-			return ERR
-		}
+	return false
+}
+
+func (parser *Parser) procedure_statement() ast.Stmt {
+	line := parser.currentLine()
+	parser.expect(CALL)
+	id := parser.expect(ID)
+
+	if parser.isBuiltinProcedure(id.Value()) {
+		return parser.builtin_procedure(id, line)
 	}
 
-	// if expression_list_prime == ERR {
-	// 	return ERR
-	// }
+	return parser.procedure_call(id, line)
+}
+
+// isProcedureCall reports whether a statement starting with the
+// identifier name is a procedure call without the call keyword. Only the
+// standard dialect allows this, and only when name is not a variable.
+func (parser *Parser) isProcedureCall(name string) bool {
+	if parser.dialect != Standard {
+		return false
+	}
 
-	return checkVar
+	return parser.scope.GetTop().FindGreenNode(name) != nil
 }
 
-func (parser *Parser) expression_list_prime(proc *GreenNode, count int) AttributeType {
-	if parser.accept(COMMA) {
-		parser.expect(COMMA)
+// procedure_call checks a call to the procedure id and parses its
+// arguments. The innermost declaration of id must be a procedure.
+func (parser *Parser) procedure_call(id Token, line int) ast.Stmt {
+	blueNode, calledProc := parser.scope.GetTop().Lookup(id.Value())
 
-		count += 1
+	if blueNode != nil {
+		kind := blueNode.GetSymbol().GetKind().String()
+		parser.listing.AddSemanticError(strings.ToUpper(kind[:1]) + kind[1:] + " " + id.Value() + " is not a procedure")
+	} else if calledProc == nil {
+		parser.listing.AddSemanticError("Procedure " + id.Value() + " not found")
+	} else {
+		calledProc.GetSymbol().AddRead(line)
+	}
 
-		vars := proc.GetVars()
-		varType := NULL
-		checkVar := vars[count].GetSymbol().GetType()
+	args := parser.procedure_statement_prime(calledProc)
+	return ast.NewProcCall(id.Value(), calledProc, args, line)
+}
 
-		expression := parser.expression()
-		expression_list_prime := parser.expression_list_prime(proc, count)
-
-		switch checkVar {
-		case PPINT:
-			varType = INT
-		case PPREAL:
-			varType = REAL
-		case PPAINT:
-			varType = AINT
-		case PPAREAL:
-			varType = AREAL
-		}
+// builtinProcedures are the predeclared procedures. A declaration with
+// the same name hides the built-in procedure.
+var builtinProcedures map[string]bool = map[string]bool{
+	"new":     true,
+	"dispose": true,
+}
 
-		if expression_list_prime == NULL {
-			params := proc.GetNumParams()
+func (parser *Parser) isBuiltinProcedure(name string) bool {
+	if !builtinProcedures[name] {
+		return false
+	}
 
-			if params > (count + 1) {
-				parser.listing.AddSemanticError("Too few parameters for call to " + proc.GetName())
-				return ERR
-			} else if params < (count + 1) {
-				parser.listing.AddSemanticError("Too many parameters for call to " + proc.GetName())
-				return ERR
-			}
-		}
+	blueNode, greenNode := parser.scope.GetTop().Lookup(name)
+	return blueNode == nil && greenNode == nil
+}
+
+// builtin_procedure parses a call to new or dispose. Both take a single
+// pointer variable; new points it at a fresh variable and dispose frees
+// the variable it points to.
+func (parser *Parser) builtin_procedure(id Token, line int) ast.Stmt {
+	parser.expect(LEFT_PAREN)
+	argLine := parser.currentLine()
+	arg := parser.expression()
+	parser.expect(RIGHT_PAREN)
+
+	if !types.IsInvalid(arg.Type()) && (!ast.IsVariable(arg) || !types.IsPointer(arg.Type())) {
+		parser.listing.AddSemanticError(id.Value() + " expects a pointer variable")
+	}
+
+	// new assigns to its argument.
+	if ident, deref := ast.Root(arg); id.Value() == "new" && ident != nil && !deref {
+		ident.Symbol.ReadToWrite(argLine)
+	}
+
+	return ast.NewProcCall(id.Value(), nil, []ast.Expr{arg}, line)
+}
 
-		if parser.CheckType(varType, expression, "Types for parameter "+strconv.Itoa(count)+" in call to "+proc.GetName()+" do not match") {
-			return ERR
+func (parser *Parser) procedure_statement_prime(proc *GreenNode) []ast.Expr {
+	if parser.accept(LEFT_PAREN) {
+		parser.expect(LEFT_PAREN)
+		args := parser.expression_list(proc)
+		parser.expect(RIGHT_PAREN)
+		return args
+	} else if parser.accept(END_DEC | SEMI | ELSE | UNTIL) {
+		// NOOP
+		if proc != nil && proc.GetNumParams() > 0 {
+			parser.listing.AddSemanticError("Too few parameters for call to " + proc.GetName())
 		}
+		return nil
+	} else {
+		// ERROR
+		parser.printError("(", "end", ";", "else", "until")
+		parser.sync(END_DEC | SEMI | ELSE | UNTIL)
+		return nil
+	}
+}
+
+func (parser *Parser) expression_list(proc *GreenNode) []ast.Expr {
+	expression := parser.expression()
+	parser.argument(proc, 0, expression)
+
+	args := parser.expression_list_prime(proc, []ast.Expr{expression})
+
+	if proc == nil {
+		return args
+	}
+
+	params := proc.GetNumParams()
+	if params > len(args) {
+		parser.listing.AddSemanticError("Too few parameters for call to " + proc.GetName())
+	} else if params < len(args) {
+		parser.listing.AddSemanticError("Too many parameters for call to " + proc.GetName())
+	}
+
+	return args
+}
+
+// expression_list_prime returns the arguments in the whole list.
+func (parser *Parser) expression_list_prime(proc *GreenNode, args []ast.Expr) []ast.Expr {
+	if parser.accept(COMMA) {
+		parser.expect(COMMA)
+
+		expression := parser.expression()
+		parser.argument(proc, len(args), expression)
 
-		return varType
+		return parser.expression_list_prime(proc, append(args, expression))
 	} else if parser.accept(RIGHT_PAREN) {
 		// NOOP
-		return NULL
+		return args
 	} else {
 		// ERROR
 		parser.printError(",", ")")
 		parser.sync(RIGHT_PAREN)
-		return ERR
+		return args
+	}
+}
+
+// argument checks the type of the argument at position count against
+// the matching formal parameter of proc.
+func (parser *Parser) argument(proc *GreenNode, count int, expression ast.Expr) {
+	if proc == nil {
+		return
+	}
+
+	params := proc.GetParams()
+	if count >= len(params) {
+		return
+	}
+
+	if !parser.CheckAssignable(expression.Type(), params[count].Type, "Types for parameter "+strconv.Itoa(count+1)+" in call to "+proc.GetName()+" do not match") {
+		parser.checkRange(expression, params[count].Type)
 	}
 }
 
-func (parser *Parser) expression() AttributeType {
+func (parser *Parser) expression() ast.Expr {
 	simple_expression := parser.simple_expression()
 	expression_prime := parser.expression_prime(simple_expression)
 
 	return expression_prime
 }
 
-func (parser *Parser) expression_prime(expr AttributeType) AttributeType {
+func (parser *Parser) expression_prime(expr ast.Expr) ast.Expr {
 	if parser.accept(RELOP) {
-		parser.expect(RELOP)
+		op := parser.expect(RELOP)
 		simple_expression := parser.simple_expression()
 
-		errMsg := "RELOP type mismatch"
-		if parser.CheckType(simple_expression, INT|REAL, errMsg) {
-			return ERR
-		}
-
-		if parser.CheckType(expr, simple_expression, errMsg) {
-			return ERR
-		}
-
-		return BOOL
-	} else if parser.accept(END_DEC | SEMI | ELSE | THEN | DO | RIGHT_BRACKET | RIGHT_PAREN | COMMA) {
+		return parser.relation(op, expr, simple_expression)
+	} else if parser.accept(RANGE) || parser.accept(END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA) {
 		// NOOP
 		return expr
 	} else {
 		// ERROR
-		parser.printError("<", "<=", ">", ">=", "=", "end", ";", "else", "then", "do", "]", ")", ",")
-		parser.sync(END_DEC | SEMI | ELSE | THEN | DO | RIGHT_BRACKET | RIGHT_PAREN | COMMA)
-		return ERR
+		parser.printError("<", "<=", ">", ">=", "=", "in", "..", "end", ";", "else", "until", "then", "do", "to", "downto", "of", "]", ")", ",")
+		parser.sync(RANGE, END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
+		return ast.NewBad()
 	}
 }
 
-func (parser *Parser) simple_expression() AttributeType {
-	if parser.accept(ID|NUM) || parser.accept(LEFT_PAREN|NOT) {
-		termType := parser.term(NULL, MULOP)
-		nextExprType := parser.simple_expression_prime(termType)
-
-		if nextExprType == NULL {
-			return termType
-		}
-
-		if nextExprType == ERR {
-			return ERR
-		}
-
-		return termType
+func (parser *Parser) simple_expression() ast.Expr {
+	if parser.accept(ID|NUM) || parser.accept(LEFT_PAREN|LEFT_BRACKET|NOT|NIL) {
+		term := parser.term()
+		return parser.simple_expression_prime(term)
 	} else if parser.accept(ADD) || parser.accept(SUB) {
-		parser.sign()
+		sign := parser.sign()
 
-		termType := parser.term(NULL, ADDOP)
-		nextExprType := parser.simple_expression_prime(termType)
+		term := parser.term()
 
 		errMsg := "Cannot use a sign on non-integers or non-reals"
-		if parser.CheckType(termType, INT|REAL, errMsg) {
-			return ERR
-		}
-
-		if nextExprType == NULL {
-			return termType
-		}
-
-		if nextExprType == ERR {
-			return ERR
+		if parser.CheckNumeric(term.Type(), errMsg) {
+			term = ast.NewBad()
+		} else {
+			term = parser.checkConstant(ast.NewUnary(sign, term, types.Arithmetic(term.Type(), term.Type())))
 		}
 
-		return termType
+		return parser.simple_expression_prime(term)
 	}
 
-	return ERR
+	// ERROR
+	parser.printError("id", "num", "(", "[", "not", "nil", "+", "-")
+	parser.sync(RELOP|RANGE, END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
+	return ast.NewBad()
 }
 
-func (parser *Parser) simple_expression_prime(typeName AttributeType) AttributeType {
+func (parser *Parser) simple_expression_prime(left ast.Expr) ast.Expr {
 	if parser.accept(ADDOP) {
-		parser.expect(ADDOP)
+		op := parser.expect(ADDOP)
 
-		termType := parser.term(typeName, ADDOP)
-		nextExprType := parser.simple_expression_prime(termType)
+		term := parser.term()
+		expr := parser.operator(op, left, term, "ADDOP type mismatch")
 
-		if nextExprType == NULL {
-			return typeName
-		}
+		return parser.simple_expression_prime(expr)
+	} else if parser.accept(RELOP|RANGE) || parser.accept(END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA) {
+		// NOOP
+		return left
+	} else {
+		// ERROR
+		parser.printError("+", "<", "<=", ">", ">=", "=", "in", "..", "end", ";", "else", "until", "then", "do", "to", "downto", "of", "]", ")", ",")
+		parser.sync(RELOP|RANGE, END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
+		return ast.NewBad()
+	}
+}
+
+func (parser *Parser) term() ast.Expr {
+	factor := parser.factor()
+	return parser.term_prime(factor)
+}
 
-		return termType
-	} else if parser.accept(RELOP) || parser.accept(END_DEC|SEMI|ELSE|THEN|DO|RIGHT_BRACKET|RIGHT_PAREN|COMMA) {
+func (parser *Parser) term_prime(left ast.Expr) ast.Expr {
+	if parser.accept(MULOP) {
+		op := parser.expect(MULOP)
+
+		factor := parser.factor()
+		term := parser.operator(op, left, factor, "MULOP type mismatch")
+
+		return parser.term_prime(term)
+	} else if parser.accept(ADDOP|RELOP|RANGE) || parser.accept(END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA) {
 		// NOOP
-		return typeName
+		return left
 	} else {
 		// ERROR
-		parser.printError("+", "<", "<=", ">", ">=", "=", "end", ";", "else", "then", "do", "]", ")", ",")
-		parser.sync(RELOP, END_DEC|SEMI|ELSE|THEN|DO|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
-		return ERR
+		parser.printError("*", "+", "<", "<=", ">", ">=", "=", "in", "..", "end", ";", "else", "until", "then", "do", "to", "downto", "of", "]", ")", ",")
+		parser.sync(ADDOP|RELOP|RANGE, END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
+		return ast.NewBad()
 	}
 }
 
-func (parser *Parser) term(typeName AttributeType, op TokenType) AttributeType {
-	factorType := parser.factor(typeName, op)
-	termType := parser.term_prime(typeName, op)
+// relation checks the operands of a RELOP and returns the comparison.
+// "in" tests an ordinal against a set, sets can be compared for equality
+// and inclusion, pointers for equality, and everything else must be two
+// numbers or two ordinals of the same type.
+func (parser *Parser) relation(op Token, left ast.Expr, right ast.Expr) ast.Expr {
+	leftType := left.Type()
+	rightType := right.Type()
+
+	if types.IsInvalid(leftType) || types.IsInvalid(rightType) {
+		return ast.NewBad()
+	}
+
+	var comparable bool
+	switch {
+	case op.Attr() == IN:
+		set, ok := rightType.(*types.Set)
+		if !ok || !types.IsOrdinal(leftType) {
+			parser.listing.AddSemanticError("Operands of in must be an ordinal and a set")
+			return ast.NewBad()
+		}
+		comparable = set.Elem == nil || types.Identical(types.Base(leftType), types.Base(set.Elem))
+	case types.IsSet(leftType) || types.IsSet(rightType):
+		switch op.Attr() {
+		case EQ, NOT_EQ, LESS_EQ, GREATER_EQ:
+			comparable = types.SetsCompatible(leftType, rightType)
+		}
+	case op.Attr() == EQ || op.Attr() == NOT_EQ:
+		comparable = types.Comparable(leftType, rightType) || types.Equatable(leftType, rightType)
+	default:
+		comparable = types.Comparable(leftType, rightType)
+	}
+
+	if !comparable {
+		parser.listing.AddSemanticError("RELOP type mismatch")
+		return ast.NewBad()
+	}
+
+	return ast.NewBinary(op.Attr(), left, right, types.Boolean)
+}
 
-	if termType == NULL {
-		return factorType
+// operator checks the operands of an ADDOP or MULOP and returns the
+// combined expression. "and" and "or" take booleans, "div" and "mod" take
+// integers, "/" always produces a real, "+", "-" and "*" on sets are
+// union, difference and intersection, and the rest promote an integer
+// operand to real when the other operand is real.
+func (parser *Parser) operator(op Token, left ast.Expr, right ast.Expr, msg string) ast.Expr {
+	leftType := left.Type()
+	rightType := right.Type()
+
+	if types.IsInvalid(leftType) || types.IsInvalid(rightType) {
+		return ast.NewBad()
 	}
 
-	if factorType == ERR || termType == ERR {
-		return ERR
+	if types.IsSet(leftType) || types.IsSet(rightType) {
+		return parser.setOperator(op, left, right, msg)
 	}
 
-	if op == MULOP {
-		if parser.CheckType(factorType, termType, "MULOP type mismatch") {
-			return ERR
+	switch op.Attr() {
+	case AND, OR:
+		if !types.IsBoolean(leftType) || !types.IsBoolean(rightType) {
+			parser.listing.AddSemanticError(msg)
+			return ast.NewBad()
 		}
-	} else {
-		return ERR
+		return ast.NewBinary(op.Attr(), left, right, types.Boolean)
+	case DIV, MOD:
+		if !types.IsInteger(leftType) || !types.IsInteger(rightType) {
+			parser.listing.AddSemanticError("Operands of " + op.Value() + " must be integers")
+			return ast.NewBad()
+		}
+		return parser.checkConstant(ast.NewBinary(op.Attr(), left, right, types.Integer))
+	}
+
+	if parser.CheckNumeric(leftType, msg) || parser.CheckNumeric(rightType, msg) {
+		return ast.NewBad()
+	}
+
+	if op.Attr() == REAL_DIV {
+		return ast.NewBinary(op.Attr(), left, right, types.Real)
 	}
 
-	return termType
+	return parser.checkConstant(ast.NewBinary(op.Attr(), left, right, types.Arithmetic(leftType, rightType)))
 }
 
-func (parser *Parser) term_prime(typeName AttributeType, op TokenType) AttributeType {
-	if parser.accept(MULOP) {
-		parser.expect(MULOP)
-		factorType := parser.factor(typeName, op)
-		return factorType
-	} else if parser.accept(ADDOP|RELOP) || parser.accept(END_DEC|SEMI|ELSE|THEN|DO|RIGHT_BRACKET|RIGHT_PAREN|COMMA) {
-		// NOOP
-		return NULL
-	} else {
-		// ERROR
-		parser.printError("*", "+", "<", "<=", ">", ">=", "=", "end", ";", "else", "then", "do", "]", ")", ",")
-		parser.sync(ADDOP|RELOP, END_DEC|SEMI|ELSE|THEN|DO|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
-		return ERR
+// setOperator checks a union, difference or intersection of two sets.
+// The result has the type of the operand that is not the empty set.
+func (parser *Parser) setOperator(op Token, left ast.Expr, right ast.Expr, msg string) ast.Expr {
+	switch op.Attr() {
+	case ADD, SUB, MUL:
+	default:
+		parser.listing.AddSemanticError("Operator " + op.Value() + " cannot be applied to sets")
+		return ast.NewBad()
+	}
+
+	if !types.SetsCompatible(left.Type(), right.Type()) {
+		parser.listing.AddSemanticError(msg)
+		return ast.NewBad()
 	}
+
+	result := left.Type()
+	if result == types.EmptySet {
+		result = right.Type()
+	}
+
+	return ast.NewBinary(op.Attr(), left, right, result)
 }
 
-func (parser *Parser) factor(typeName AttributeType, op TokenType) AttributeType {
+func (parser *Parser) factor() ast.Expr {
 	if parser.accept(NUM) {
 		num := parser.expect(NUM)
 
-		if op == ADDOP && parser.CheckType(typeName, num.Attr(), "ADDOP type mismatch") {
-			return ERR
+		kind := token.INT
+		if num.Attr() != INT {
+			kind = token.FLOAT
 		}
 
-		return num.Attr()
+		return parser.checkConstant(ast.NewLiteral(constant.MakeFromLiteral(num.Value(), kind, 0), numType(num)))
 	} else if parser.accept(LEFT_PAREN) {
 		parser.expect(LEFT_PAREN)
 		expression := parser.expression()
@@ -963,85 +2287,275 @@ func (parser *Parser) factor(typeName AttributeType, op TokenType) AttributeType
 
 		return expression
 	} else if parser.accept(ID) {
+		line := parser.currentLine()
 		id := parser.expect(ID)
 
 		blueNode, err := parser.scope.GetTop().FindBlueNode(id.Value())
 		if err != nil {
+			if builtins[id.Value()] && parser.accept(LEFT_PAREN) {
+				return parser.factor_prime(parser.builtin_call(id))
+			}
+
 			parser.listing.AddSemanticError("Could not find variable " + id.Value())
-			return ERR
+			parser.factor_prime(ast.NewBad())
+			return ast.NewBad()
 		}
 
 		sym := blueNode.GetSymbol()
-		symType := sym.GetType()
 
-		switch symType {
-		case PPINT:
-			symType = INT
-		case PPREAL:
-			symType = REAL
+		switch sym.GetKind() {
+		case VariableSym, ParameterSym:
+			sym.AddRead(line)
+			return parser.factor_prime(ast.NewIdent(id.Value(), sym, sym.GetType()))
+		case ConstantSym:
+			sym.AddRead(line)
+			value := constant.MakeInt64(int64(sym.GetValue().(int)))
+			return parser.factor_prime(ast.NewLiteral(value, sym.GetType()))
+		default:
+			parser.listing.AddSemanticError("Cannot use " + sym.GetKind().String() + " " + id.Value() + " in an expression")
+			parser.factor_prime(ast.NewBad())
+			return ast.NewBad()
 		}
+	} else if parser.accept(LEFT_BRACKET) {
+		return parser.set_constructor()
+	} else if parser.accept(NIL) {
+		parser.expect(NIL)
+		return ast.NewNil()
+	} else if parser.accept(NOT) {
+		parser.expect(NOT)
+		factor := parser.factor()
 
-		factor_prime := parser.factor_prime(symType)
+		if types.IsInvalid(factor.Type()) {
+			return ast.NewBad()
+		}
 
-		if symType == factor_prime {
-			return factor_prime
+		if !types.IsBoolean(factor.Type()) {
+			parser.listing.AddSemanticError("Only boolean expressions can be negated")
+			return ast.NewBad()
 		}
 
-		if symType == symType&(INT|AINT) {
-			if factor_prime != factor_prime&(INT|AINT) {
-				return ERR
+		return ast.NewUnary(NOT, factor, types.Boolean)
+	} else {
+		// ERROR
+		parser.printError("a number", "(", "[", "an identifier", "nil", "not")
+		parser.sync(LEFT_PAREN|LEFT_BRACKET|NOT|NIL, ID)
+		return ast.NewBad()
+	}
+}
+
+// set_constructor parses a bracketed list of set elements, each a value
+// or a range of values. All elements must be ordinals of the same type.
+func (parser *Parser) set_constructor() ast.Expr {
+	parser.expect(LEFT_BRACKET)
+
+	if parser.accept(RIGHT_BRACKET) {
+		parser.expect(RIGHT_BRACKET)
+		return ast.NewSet(nil, types.EmptySet)
+	}
+
+	elems := parser.set_element_list(make([]ast.Expr, 0))
+	parser.expect(RIGHT_BRACKET)
+
+	var elem types.Type
+	for _, e := range elems {
+		var typeName types.Type
+		switch r := e.(type) {
+		case *ast.Range:
+			if types.IsInvalid(r.High.Type()) {
+				return ast.NewBad()
 			}
-			return INT
-		} else if symType == symType&(REAL|AREAL) {
-			if factor_prime != factor_prime&(REAL|AREAL) {
-				return ERR
+			if !types.Identical(types.Base(r.Low.Type()), types.Base(r.High.Type())) {
+				parser.listing.AddSemanticError("Set elements must all be of the same type")
+				return ast.NewBad()
 			}
-			return REAL
+			typeName = r.Low.Type()
+		default:
+			typeName = e.Type()
 		}
 
-		return ERR
-	} else if parser.accept(NOT) {
-		parser.expect(NOT)
-		factor := parser.factor(typeName, op)
+		if types.IsInvalid(typeName) {
+			return ast.NewBad()
+		}
+
+		if !types.IsOrdinal(typeName) {
+			parser.listing.AddSemanticError("Set elements must be ordinal, not " + typeName.String())
+			return ast.NewBad()
+		}
+
+		if elem == nil {
+			elem = types.Base(typeName)
+		} else if !types.Identical(elem, types.Base(typeName)) {
+			parser.listing.AddSemanticError("Set elements must all be of the same type")
+			return ast.NewBad()
+		}
+	}
 
-		if factor == BOOL {
-			return BOOL
+	for _, e := range elems {
+		if r, ok := e.(*ast.Range); ok {
+			parser.checkSetElem(r.Low)
+			parser.checkSetElem(r.High)
 		} else {
-			return ERR
+			parser.checkSetElem(e)
 		}
+	}
+
+	return ast.NewSet(elems, types.NewSet(elem))
+}
+
+func (parser *Parser) set_element_list(elems []ast.Expr) []ast.Expr {
+	low := parser.expression()
+
+	if parser.accept(RANGE) {
+		parser.expect(RANGE)
+		high := parser.expression()
+		elems = append(elems, ast.NewRange(low, high))
 	} else {
-		// ERROR
-		parser.printError("a number", "(", "an identifier", "not")
-		parser.sync(LEFT_PAREN|NOT, ID)
-		return ERR
+		elems = append(elems, low)
+	}
+
+	if parser.accept(COMMA) {
+		parser.expect(COMMA)
+		return parser.set_element_list(elems)
+	}
+
+	return elems
+}
+
+// checkSetElem reports a constant set element that does not fit in a
+// set.
+func (parser *Parser) checkSetElem(expr ast.Expr) {
+	value, ok := ast.IntValue(expr)
+	if ok && (value < 0 || value > types.MaxSetElem) {
+		parser.listing.AddSemanticError("Set element " + types.OrdinalString(expr.Type(), value) + " is out of range 0.." + strconv.Itoa(types.MaxSetElem))
+	}
+}
+
+// builtins are the predeclared functions. A variable with the same name
+// hides the built-in function.
+var builtins map[string]bool = map[string]bool{
+	"ord":  true,
+	"succ": true,
+	"pred": true,
+	"low":  true,
+	"high": true,
+}
+
+// builtin_call parses the argument of a built-in function. ord returns
+// the ordinal number of its argument, succ and pred return the next and
+// previous value of the same type, and low and high return the bounds of
+// an array.
+func (parser *Parser) builtin_call(id Token) ast.Expr {
+	parser.expect(LEFT_PAREN)
+	arg := parser.expression()
+	parser.expect(RIGHT_PAREN)
+
+	argType := arg.Type()
+	if types.IsInvalid(argType) {
+		return ast.NewBad()
+	}
+
+	if id.Value() == "low" || id.Value() == "high" {
+		return parser.arrayBound(id, arg)
+	}
+
+	if !types.IsOrdinal(argType) {
+		parser.listing.AddSemanticError(id.Value() + " expects an ordinal argument, not " + argType.String())
+		return ast.NewBad()
+	}
+
+	if id.Value() == "ord" {
+		return ast.NewCall(id.Value(), []ast.Expr{arg}, types.Integer)
+	}
+
+	call := ast.NewCall(id.Value(), []ast.Expr{arg}, types.Base(argType))
+	if parser.checkRange(call, types.Base(argType)) {
+		return ast.NewBad()
+	}
+
+	return parser.checkConstant(call)
+}
+
+// checkConstant reports an integer constant expression whose value does
+// not fit in an integer, and replaces it with a bad expression so that
+// the expressions built from it do not report it again.
+func (parser *Parser) checkConstant(expr ast.Expr) ast.Expr {
+	if !types.IsInteger(expr.Type()) {
+		return expr
+	}
+
+	value := ast.Constant(expr)
+	if value == nil || value.Kind() != constant.Int {
+		return expr
+	}
+
+	if constant.Compare(value, token.LSS, constant.MakeInt64(types.MinInteger)) || constant.Compare(value, token.GTR, constant.MakeInt64(types.MaxInteger)) {
+		parser.listing.AddSemanticError("Integer constant " + value.ExactString() + " is out of range " + strconv.Itoa(types.MinInteger) + ".." + strconv.Itoa(types.MaxInteger))
+		return ast.NewBad()
+	}
+
+	return expr
+}
+
+// arrayBound returns the lowest or highest index of an array. The bounds
+// of a declared array are constants of its index type. An open array
+// always starts at 0 and its highest index is the hidden argument passed
+// with it.
+func (parser *Parser) arrayBound(id Token, arg ast.Expr) ast.Expr {
+	switch array := arg.Type().(type) {
+	case *types.Array:
+		bound := array.Low
+		if id.Value() == "high" {
+			bound = array.High
+		}
+		return ast.NewLiteral(constant.MakeInt64(int64(bound)), array.Index)
+	case *types.OpenArray:
+		if id.Value() == "low" {
+			return ast.NewLiteral(constant.MakeInt64(0), types.Integer)
+		}
+		return ast.NewCall(id.Value(), []ast.Expr{arg}, types.Integer)
 	}
+
+	parser.listing.AddSemanticError(id.Value() + " expects an array, not " + arg.Type().String())
+	return ast.NewBad()
 }
 
-func (parser *Parser) factor_prime(prevType AttributeType) AttributeType {
+func (parser *Parser) factor_prime(prev ast.Expr) ast.Expr {
 	if parser.accept(LEFT_BRACKET) {
 		parser.expect(LEFT_BRACKET)
-		expression := parser.expression()
+		elem := parser.index_list(prev)
 		parser.expect(RIGHT_BRACKET)
 
-		return expression
-	} else if parser.accept(ADDOP|MULOP|RELOP) || parser.accept(END_DEC|SEMI|ELSE|THEN|DO|RIGHT_BRACKET|RIGHT_PAREN|COMMA) {
+		return parser.factor_prime(elem)
+	} else if parser.accept(END) {
+		parser.expect(END)
+		field := parser.expect(ID)
+
+		return parser.factor_prime(parser.selectField(prev, field))
+	} else if parser.accept(CARET) {
+		parser.expect(CARET)
+
+		return parser.factor_prime(parser.deref(prev))
+	} else if parser.accept(ADDOP|MULOP|RELOP|RANGE) || parser.accept(END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA) {
 		// NOOP
-		return prevType
+		return prev
 	} else {
 		// ERROR
-		parser.printError("[", "*", "+", "<", "<=", ">", ">=", "=", "end", ";", "else", "then", "do", "]", ")", ",")
-		parser.sync(ADDOP|MULOP|RELOP, END_DEC|SEMI|ELSE|THEN|DO|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
-		return ERR
+		parser.printError("[", ".", "^", "*", "+", "<", "<=", ">", ">=", "=", "in", "..", "end", ";", "else", "until", "then", "do", "to", "downto", "of", "]", ")", ",")
+		parser.sync(ADDOP|MULOP|RELOP|RANGE, END_DEC|SEMI|ELSE|UNTIL|THEN|DO|TO|DOWNTO|OF|RIGHT_BRACKET|RIGHT_PAREN|COMMA)
+		return ast.NewBad()
 	}
 }
 
-func (parser *Parser) sign() {
+func (parser *Parser) sign() AttributeType {
 	if parser.accept(ADD) {
 		parser.expect(ADD)
+		return ADD
 	} else if parser.accept(SUB) {
 		parser.expect(SUB)
+		return SUB
 	} else {
 		// ERROR
 		parser.printError("+", "-")
+		return NULL
 	}
 }
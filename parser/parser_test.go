@@ -0,0 +1,1447 @@
+package parser
+
+import (
+	scan "compiler/scanner"
+	"compiler/util"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compile parses src in the standard dialect in a new directory, which
+// is left as the working directory so that the files Begin writes can
+// be read with output.
+func compile(t *testing.T, src string, setup func(*Parser)) {
+	t.Helper()
+
+	chdirTemp(t)
+	recompile(t, src, setup)
+}
+
+// chdirTemp changes to a new directory until the test ends.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// recompile parses src like compile, but in the current directory, so
+// that files written before, such as the sources of units, are seen.
+func recompile(t *testing.T, src string, setup func(*Parser)) {
+	t.Helper()
+
+	if err := os.WriteFile("test.pas", []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := scan.NewScanner()
+	scanner.ReadReservedFile(reservedWords)
+	scanner.ReadSourceFile("test.pas")
+
+	parser := NewParser(scanner)
+	parser.SetDialect(Standard)
+	if setup != nil {
+		setup(&parser)
+	}
+	parser.Begin("test.pas")
+}
+
+// reservedWords is the absolute path of the reserved word list, which
+// stays valid when a test changes the working directory.
+var reservedWords = func() string {
+	path, err := filepath.Abs("../scanner/reserved_words.list")
+	if err != nil {
+		panic(err)
+	}
+	return path
+}()
+
+// write writes a file, such as the source of a unit, to the current
+// directory.
+func write(t *testing.T, file string, src string) {
+	t.Helper()
+
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func output(t *testing.T, file string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// diagnostics returns the errors and warnings in the listing.
+func diagnostics(t *testing.T) []string {
+	t.Helper()
+
+	var lines []string
+	for _, line := range strings.Split(output(t, "listing_file.txt"), "\n") {
+		if strings.Contains(line, "Error: ") || strings.HasPrefix(line, "Warning: ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// warnings returns the warnings in the listing, each prefixed with the
+// number of the line it is reported on.
+func warnings(t *testing.T) []string {
+	t.Helper()
+
+	var lines []string
+	number := ""
+	for _, line := range strings.Split(output(t, "listing_file.txt"), "\n") {
+		if prefix, _, ok := strings.Cut(line, ": "); ok && strings.Trim(prefix, "0123456789") == "" {
+			number = prefix
+		} else if warning, ok := strings.CutPrefix(line, "Warning: "); ok {
+			lines = append(lines, number+": "+warning)
+		}
+	}
+	return lines
+}
+
+// countLines returns the number of lines of text whose fields start
+// with fields.
+func countLines(text string, fields ...string) int {
+	count := 0
+	for _, line := range strings.Split(text, "\n") {
+		f := strings.Fields(line)
+		if len(f) >= len(fields) && strings.Join(f[:len(fields)], " ") == strings.Join(fields, " ") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestTypeMismatches(t *testing.T) {
+	compile(t, `program test(input, output);
+var a: array [1..3] of integer;
+var r: real;
+var i: integer;
+begin
+  i := 2;
+  r := 1.5;
+  a[i] := r;
+  a[r] := i;
+  i := r;
+  if i then
+    i := 1
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: Only use integers as array indices",
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: Only boolean expressions are allowed in if statements",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestMissingOperand(t *testing.T) {
+	compile(t, `program test(input, output);
+var g: integer;
+begin
+  g := 1;
+  if g < then
+    g := 2
+end.
+`, nil)
+
+	want := []string{`Syntax Error: expected "id", or "num", or "(", or "[", or "not", or "nil", or "+", or "-", got "then"`}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestBooleanIsPredeclared(t *testing.T) {
+	compile(t, `program test(input, output);
+var b: boolean;
+var g: integer;
+begin
+  g := 1;
+  b := g > 0;
+  if b then
+    g := 2;
+  b := g
+end.
+`, nil)
+
+	want := []string{"Semantic Error: ASSIGNOP type mismatch"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	compile(t, `program test(input, output);
+var p: record x: integer; y: real; x: integer end;
+var q: record a: integer; b: record c: real; d: integer end end;
+begin
+  p.x := 1;
+  p.y := 2.5;
+  q.b.d := p.x;
+  q.b.c := p.y;
+  p.z := 1;
+  p.x := p.y
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Field x already declared",
+		"Semantic Error: Record has no field z",
+		"Semantic Error: ASSIGNOP type mismatch",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestMultiDimensionalArrays(t *testing.T) {
+	compile(t, `program test(input, output);
+var m: array [1..3, 0..4] of integer;
+var n: array [1..3] of array [0..4] of integer;
+var i: integer;
+begin
+  m[1, 0] := 1;
+  n[2][4] := m[1, 0];
+  m[1][2] := n[2, 4];
+  i := m[1];
+  i := n[1, 2, 3]
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: Cannot index a variable of type integer",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	compile(t, `program test(input, output);
+var a: array [1..10] of integer;
+var i: integer;
+var r: real;
+begin
+  for i := 1 to 10 do
+    a[i] := i;
+  for i := 10 downto 1 do
+    a[i] := a[i] + 1;
+  for r := 1 to 10 do
+    a[1] := 0;
+  for i := 1 to 2.5 do
+    a[1] := 0;
+  for i := 1 to 10 do
+    i := 2
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: For loop control variable r must be an integer",
+		"Semantic Error: Final value of a for loop must be an integer",
+		"Semantic Error: Cannot assign to for loop control variable i",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestRepeatLoops(t *testing.T) {
+	compile(t, `program test(input, output);
+var i: integer;
+begin
+  i := 0;
+  repeat
+    i := i + 1;
+    i := i + 1
+  until i > 10;
+  repeat
+    i := i - 1
+  until i
+end.
+`, nil)
+
+	want := []string{"Semantic Error: Only boolean expressions are allowed in repeat statements"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestEmptyRepeatBody(t *testing.T) {
+	compile(t, `program test(input, output);
+var g: integer;
+begin
+  g := 1;
+  repeat
+  until g > 0
+end.
+`, nil)
+
+	if errs := diagnostics(t); len(errs) != 0 {
+		t.Errorf("unexpected diagnostics: %q", errs)
+	}
+}
+
+func TestCaseStatements(t *testing.T) {
+	compile(t, `program test(input, output);
+var i: integer;
+var r: real;
+begin
+  i := 3;
+  case i of
+    1: i := 2;
+    2, 3: i := 4;
+    5..9: i := 0;
+    8: i := 1
+  end;
+  r := 1.0;
+  case r of
+    1: i := 0
+  end
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Case label 8 overlaps label 5..9 on line 9",
+		"Semantic Error: Case selector must be of an ordinal type, not real",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestForwardDeclarations(t *testing.T) {
+	compile(t, `program test(input, output);
+var g: integer;
+procedure ping(n: integer); forward;
+procedure pong(n: integer);
+begin
+  if n > 0 then
+    call ping(n - 1)
+end;
+procedure ping(n: integer);
+begin
+  if n > 0 then
+    call pong(n - 1)
+end;
+procedure lost(n: integer); forward;
+begin
+  g := 4;
+  call ping(g)
+end.
+`, nil)
+
+	want := []string{"Semantic Error: Procedure lost declared forward on line 14 is never defined"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+const forwardProgram = `program test(input, output);
+var g: integer;
+procedure odd(n: integer); forward;
+procedure even(n: integer); forward;
+procedure even(n: integer);
+begin
+  if n > 0 then
+    call odd(n - 1)
+end;
+procedure odd(n: integer);
+begin
+  if n > 0 then
+    call even(n - 1)
+end;
+procedure noparams(k: integer); forward;
+procedure noparams;
+begin
+  g := k
+end;
+begin
+  call even(4);
+  call noparams(1);
+  g := g + 1
+end.
+`
+
+func TestForwardParametersAreListedOnce(t *testing.T) {
+	compile(t, forwardProgram, nil)
+
+	if errs := diagnostics(t); len(errs) != 0 {
+		t.Fatalf("unexpected diagnostics: %q", errs)
+	}
+	symbols := output(t, "symbol_file.txt")
+	for _, scope := range []string{"test/even", "test/odd"} {
+		if n := countLines(symbols, scope, "n", "parameter"); n != 1 {
+			t.Errorf("parameter n of %s is listed %d times, want 1:\n%s", scope, n, symbols)
+		}
+	}
+	if n := countLines(symbols, "test/noparams", "k", "parameter"); n != 1 {
+		t.Errorf("parameter k of test/noparams is listed %d times, want 1:\n%s", n, symbols)
+	}
+}
+
+func TestIntegerPromotion(t *testing.T) {
+	compile(t, `program test(input, output);
+var r: real;
+var i: integer;
+procedure scale(x: real);
+begin
+  r := x * 2
+end;
+begin
+  i := 3;
+  r := i;
+  r := i + 0.5;
+  r := i / 2;
+  call scale(i);
+  if r > i then
+    i := r
+end.
+`, nil)
+
+	want := []string{"Semantic Error: ASSIGNOP type mismatch"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestEnumerationsAndSubranges(t *testing.T) {
+	compile(t, `program test(input, output);
+type
+  color = (red, green, blue);
+  warm = red..green;
+  digit = 0..9;
+  empty = 9..0;
+var c: color;
+var w: warm;
+var d: digit;
+var i: integer;
+begin
+  c := blue;
+  w := c;
+  d := 10;
+  i := d;
+  c := 1;
+  w := blue
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Lower bound 9 is greater than upper bound 0",
+		"Semantic Error: Value 10 is out of range 0..9",
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: Value blue is out of range red..green",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestPointers(t *testing.T) {
+	compile(t, `program test(input, output);
+type
+  link = ^node;
+  node = record val: integer; next: link end;
+  flag = ^boolean;
+  lost = ^missing;
+var head: link;
+var f: flag;
+var i: integer;
+begin
+  new(head);
+  head^.val := 1;
+  head^.next := nil;
+  new(f);
+  f^ := head^.val > 0;
+  i := head^.next;
+  dispose(head);
+  dispose(i)
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Type missing used by a pointer on line 6 is never declared",
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: dispose expects a pointer variable",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestSets(t *testing.T) {
+	compile(t, `program test(input, output);
+type
+  color = (red, green, blue);
+  colors = set of color;
+  big = set of 0..100;
+var s: colors;
+var t: colors;
+var d: set of 1..9;
+var b: boolean;
+begin
+  s := [red, blue];
+  t := s + [green];
+  t := t * s - [red];
+  b := green in t;
+  d := [1..3, 7];
+  s := d;
+  b := 3 in s
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Set base type must be an ordinal type with values in 0..63, not 0..100",
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: RELOP type mismatch",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestUnits(t *testing.T) {
+	chdirTemp(t)
+	write(t, "counter.pas", `unit counter;
+interface
+var count: integer;
+procedure bump(n: integer);
+implementation
+var hidden: integer;
+procedure bump(n: integer);
+begin
+  hidden := n;
+  count := count + hidden
+end;
+end.
+`)
+	recompile(t, `program test(input, output);
+uses counter;
+begin
+  count := 0;
+  call bump(2);
+  hidden := 1
+end.
+`, nil)
+
+	want := []string{"Semantic Error: Could not find variable hidden"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+	if sym := output(t, "counter.sym"); !strings.Contains(sym, `"count"`) || strings.Contains(sym, `"hidden"`) {
+		t.Errorf("counter.sym does not export just the interface:\n%s", sym)
+	}
+
+	recompile(t, `program test(input, output);
+uses nowhere;
+begin
+end.
+`, nil)
+
+	want = []string{"Semantic Error: Unit nowhere not found"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+const counterUnit = `unit counter;
+interface
+var count: integer;
+procedure bump;
+implementation
+procedure bump;
+begin
+  count := count + 1
+end;
+end.
+`
+
+const counterProgram = `program test(input, output);
+uses counter;
+begin
+  count := 0;
+  call bump
+end.
+`
+
+func TestUnitIsRebuiltOnlyWhenItsInterfaceChanges(t *testing.T) {
+	chdirTemp(t)
+	write(t, "counter.pas", counterUnit)
+	recompile(t, counterProgram, nil)
+	if errs := diagnostics(t); len(errs) != 0 {
+		t.Fatalf("unexpected diagnostics: %q", errs)
+	}
+	built := output(t, "counter.sym")
+
+	// An error in the implementation section is not seen, since the unit
+	// is not rebuilt.
+	write(t, "counter.pas", strings.Replace(counterUnit, "count + 1", "count + missing", 1))
+	recompile(t, counterProgram, nil)
+	if errs := diagnostics(t); len(errs) != 0 {
+		t.Errorf("implementation change: unexpected diagnostics: %q", errs)
+	}
+	if sym := output(t, "counter.sym"); sym != built {
+		t.Errorf("implementation change rewrote counter.sym:\n%s", sym)
+	}
+
+	// A new export is seen, since the unit is rebuilt.
+	write(t, "counter.pas", strings.Replace(counterUnit, "procedure bump;\nimpl", "var total: integer;\nprocedure bump;\nimpl", 1))
+	recompile(t, strings.Replace(counterProgram, "bump\n", "bump;\n  total := count\n", 1), nil)
+	if errs := diagnostics(t); len(errs) != 0 {
+		t.Errorf("interface change: unexpected diagnostics: %q", errs)
+	}
+	if sym := output(t, "counter.sym"); !strings.Contains(sym, `"total"`) {
+		t.Errorf("interface change did not rebuild counter.sym:\n%s", sym)
+	}
+}
+
+func TestOpenArrays(t *testing.T) {
+	compile(t, `program test(input, output);
+var a: array [1..5] of integer;
+var b: array [0..2] of real;
+var g: integer;
+procedure sum(v: array of integer);
+var i: integer;
+begin
+  g := 0;
+  for i := low(v) to high(v) do
+    g := g + v[i]
+end;
+begin
+  a[1] := 1;
+  call sum(a);
+  call sum(b)
+end.
+`, nil)
+
+	want := []string{"Semantic Error: Types for parameter 1 in call to sum do not match"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	compile(t, `program test(input, output);
+var i: integer;
+procedure find(n: integer);
+begin
+  i := 0;
+  while i < 10 do
+  begin
+    i := i + 1;
+    if i = n then
+      exit;
+    if i > 5 then
+      break
+    else
+      continue
+  end
+end;
+begin
+  call find(3);
+  break
+end.
+`, nil)
+
+	want := []string{"Semantic Error: break on line 19 is not inside a while, for or repeat loop"}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+const dialectProgram = `program test(input, output);
+var g: integer;
+procedure p(n: integer);
+begin
+  g := n
+end;
+procedure q;
+begin
+  g := 0
+end;
+begin
+  p(1);
+  q;
+  call p(2);
+  g(3)
+end.
+`
+
+func TestDialects(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    []string
+	}{
+		{Standard, []string{`Syntax Error: expected "[", or ".", or "^", or ":=", got "("`}},
+		{Legacy, []string{
+			"Semantic Error: Could not find variable p",
+			`Syntax Error: expected "[", or ".", or "^", or ":=", got "("`,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dialect.String(), func(t *testing.T) {
+			compile(t, dialectProgram, func(parser *Parser) {
+				parser.SetDialect(test.dialect)
+			})
+			got := diagnostics(t)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("diagnostics = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNestedScopes(t *testing.T) {
+	compile(t, `program test(input, output);
+var x: integer;
+var y: real;
+procedure outer;
+var x: real;
+  procedure inner;
+  var y: integer;
+  begin
+    y := 1;
+    x := 2.5;
+    y := x
+  end;
+begin
+  x := 1.5;
+  inner
+end;
+procedure other;
+begin
+  x := 1.5;
+  y := 2.0;
+  z := 3
+end;
+begin
+  outer;
+  other
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: ASSIGNOP type mismatch",
+		"Semantic Error: Could not find variable z",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestRedeclarations(t *testing.T) {
+	compile(t, `program test(input, output);
+var x: integer;
+var y: integer;
+var y: real;
+procedure p(k: integer);
+var k: real;
+var x: integer;
+begin
+  x := k
+end;
+begin
+  x := 1;
+  call p(x)
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Variable y already declared on line 3",
+		"Semantic Error: Variable k already declared as a parameter on line 5",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestShadowing(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "procedure shadows variable",
+			src: `program test(input, output);
+var p: integer;
+procedure outer;
+  procedure p;
+  begin
+  end;
+begin
+  p
+end;
+begin
+  p := 1;
+  if p > 0 then
+    outer
+end.
+`,
+		},
+		{
+			name: "variable shadows procedure",
+			src: `program test(input, output);
+var g: integer;
+procedure q;
+begin
+end;
+procedure r;
+var q: integer;
+begin
+  q := 2;
+  g := q
+end;
+begin
+  q;
+  r;
+  g := g + 1
+end.
+`,
+		},
+		{
+			name: "call of a variable that shadows a procedure",
+			src: `program test(input, output);
+procedure q;
+begin
+end;
+procedure r;
+var q: integer;
+begin
+  q := 2;
+  call q
+end;
+begin
+  q;
+  r
+end.
+`,
+			want: []string{"Semantic Error: Variable q is not a procedure"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compile(t, test.src, nil)
+			got := diagnostics(t)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("diagnostics = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+const nestedProgram = `program test(input, output);
+var g: integer;
+procedure outer(a: integer; b: real);
+var c: integer;
+var d: real;
+  procedure inner;
+  var e: integer;
+  begin
+    e := c;
+    g := e
+  end;
+begin
+  c := a;
+  d := b;
+  call inner
+end;
+begin
+  g := 0;
+  call outer(g, 1.0)
+end.
+`
+
+func TestFrameLayout(t *testing.T) {
+	compile(t, nestedProgram, nil)
+
+	offsets := output(t, "memory_offsets.txt")
+	for _, want := range []string{"level 1, frame size 40", "level 2, frame size 24"} {
+		if !strings.Contains(offsets, want) {
+			t.Errorf("memory_offsets.txt has no frame with %s:\n%s", want, offsets)
+		}
+	}
+	for _, want := range [][]string{
+		{"+12", "b", "real", "8"},
+		{"+8", "a", "integer", "4"},
+		{"-16", "d", "real", "8"},
+		{"+8", "static", "link", "4"},
+		{"-4", "e", "integer", "4"},
+	} {
+		if countLines(offsets, want...) != 1 {
+			t.Errorf("memory_offsets.txt has no line %q:\n%s", want, offsets)
+		}
+	}
+}
+
+func TestParameterLayout(t *testing.T) {
+	compile(t, `program test(input, output);
+type point = record x: real; y: integer end;
+var g: real;
+var pt: point;
+procedure p(k: integer; q: point; r: real);
+var l: point;
+begin
+  l := q;
+  g := l.x + r + k
+end;
+begin
+  pt.x := 0.0;
+  pt.y := 0;
+  call p(1, pt, 2.0)
+end.
+`, nil)
+
+	offsets := output(t, "memory_offsets.txt")
+	for _, want := range [][]string{
+		{"+12", "q.x", "real", "8"},
+		{"+20", "q.y", "integer", "4"},
+		{"-16", "l.x", "real", "8"},
+	} {
+		if countLines(offsets, want...) != 1 {
+			t.Errorf("memory_offsets.txt has no line %q:\n%s", want, offsets)
+		}
+	}
+
+	var layout struct{ Frames []*util.Frame }
+	if err := json.Unmarshal([]byte(output(t, "memory_offsets.json")), &layout); err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range layout.Frames {
+		for _, slot := range frame.Params {
+			if slot.Align != 4 || slot.Offset%slot.Align != 0 {
+				t.Errorf("%s of %s is at offset %d with alignment %d, want a word", slot.Name, frame.Name, slot.Offset, slot.Align)
+			}
+		}
+	}
+}
+
+func TestCrossReference(t *testing.T) {
+	compile(t, nestedProgram, func(parser *Parser) {
+		parser.SetCrossReference(true)
+	})
+
+	xref := output(t, "xref.txt")
+	for _, want := range [][]string{
+		{"c", "test/outer", "variable", "integer", "4", "9", "13"},
+		{"d", "test/outer", "variable", "real", "5", "-", "14"},
+		{"g", "test", "variable", "integer", "2", "19", "10, 18"},
+		{"inner", "test/outer", "procedure", "procedure()", "6", "15", "-"},
+	} {
+		if countLines(xref, strings.Fields(strings.Join(want, " "))...) != 1 {
+			t.Errorf("xref.txt has no entry %q:\n%s", want, xref)
+		}
+	}
+}
+
+func TestForwardParametersAreCrossReferencedOnce(t *testing.T) {
+	compile(t, forwardProgram, func(parser *Parser) {
+		parser.SetCrossReference(true)
+	})
+
+	xref := output(t, "xref.txt")
+	for _, want := range [][]string{
+		{"n", "test/even", "parameter", "integer", "5", "7, 8", "-"},
+		{"n", "test/odd", "parameter", "integer", "10", "12, 13", "-"},
+		{"k", "test/noparams", "parameter", "integer", "15", "18", "-"},
+	} {
+		if n := countLines(xref, want[:2]...); n != 1 {
+			t.Errorf("%s of %s has %d entries, want 1:\n%s", want[0], want[1], n, xref)
+		} else if countLines(xref, strings.Fields(strings.Join(want, " "))...) != 1 {
+			t.Errorf("entry of %s of %s is not %q:\n%s", want[0], want[1], want, xref)
+		}
+	}
+}
+
+const warningProgram = `program test(input, output);
+var g: integer;
+var spare: integer;
+procedure p(k: integer; unused: integer);
+var u: integer;
+var v: integer;
+var w: integer;
+begin
+  w := 1;
+  v := 1;
+  v := 2;
+  if k > 0 then
+    u := 1;
+  g := u + k + v
+end;
+procedure never;
+begin
+  g := 0
+end;
+begin
+  g := 0;
+  call p(g, 1)
+end.
+`
+
+func TestWarnings(t *testing.T) {
+	want := []string{
+		"3: Variable spare is never used [unused]",
+		"4: Parameter unused is never used [unused]",
+		"7: Variable w is assigned but never used [unused]",
+		"10: Value assigned to v is never read [dead-assignment]",
+		"14: Variable u may be read before it is assigned [uninitialized]",
+		"16: Procedure never is never called [uncalled]",
+	}
+	compile(t, warningProgram, nil)
+	if got := warnings(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+
+	compile(t, warningProgram, func(parser *Parser) {
+		parser.SuppressWarning(util.Unused)
+	})
+	if got := warnings(t); strings.Join(got, "\n") != strings.Join(want[3:], "\n") {
+		t.Errorf("warnings without unused = %q, want %q", got, want[3:])
+	}
+}
+
+func TestUnreachableCode(t *testing.T) {
+	compile(t, `program test(input, output);
+var g: integer;
+procedure p;
+begin
+  g := 1;
+  exit;
+  g := 2
+end;
+begin
+  g := 0;
+  while 1 = 2 do
+    g := g + 1;
+  if g < 0 then
+    call p
+  else
+    g := 3;
+  if 2 > 1 then
+    g := 4
+  else
+    g := 5
+end.
+`, nil)
+
+	want := []string{
+		"7: Unreachable code [unreachable]",
+		"11: Condition is always false [constant-condition]",
+		"12: Unreachable code [unreachable]",
+		"17: Condition is always true [constant-condition]",
+		"20: Unreachable code [unreachable]",
+	}
+	if got := warnings(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+}
+
+func TestRepeatConditionIsReportedOnUntilLine(t *testing.T) {
+	compile(t, `program test(input, output);
+var i: integer;
+procedure step;
+begin
+  i := i + 1
+end;
+begin
+  i := 0;
+  repeat
+    step
+  until
+    1 = 1
+end.
+`, nil)
+
+	want := []string{"12: Condition is always true [constant-condition]"}
+	if got := warnings(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+}
+
+func TestConstantIndices(t *testing.T) {
+	compile(t, `program test(input, output);
+var k: array [1..5] of integer;
+var m: array [0..2, 0..3] of integer;
+begin
+  k[5] := 1;
+  k[7] := 2;
+  k[2 * 3] := 3;
+  m[2, 4] := 4;
+  k[1] := m[3][0]
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Array index 7 is out of range 1..5",
+		"Semantic Error: Array index 6 is out of range 1..5",
+		"Semantic Error: Array index 4 is out of range 0..3",
+		"Semantic Error: Array index 3 is out of range 0..2",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestIntegerConstantOverflow(t *testing.T) {
+	compile(t, `program test(input, output);
+var a: array [1..10] of integer;
+var i: integer;
+begin
+  a[9999999999] := 1;
+  i := 65536 * 65536 * 65536;
+  i := -2147483647 - 1;
+  i := succ(2147483647);
+  a[i] := 1
+end.
+`, nil)
+
+	want := []string{
+		"Semantic Error: Integer constant 9999999999 is out of range -2147483648..2147483647",
+		"Semantic Error: Integer constant 4294967296 is out of range -2147483648..2147483647",
+		"Semantic Error: Integer constant 2147483648 is out of range -2147483648..2147483647",
+	}
+	if got := diagnostics(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", got, want)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "accumulator",
+			src: `program test(input, output);
+procedure sum;
+var i: integer;
+var j: integer;
+begin
+  j := 0;
+  for i := 10 downto 1 do
+    j := j + i;
+  if j > 0 then
+    sum
+end;
+begin
+  sum
+end.
+`,
+		},
+		{
+			name: "countdown",
+			src: `program test(input, output);
+var i: integer;
+var k: integer;
+begin
+  i := 10;
+  k := 0;
+  repeat
+    i := i - 1;
+    k := k + i
+  until i = 0
+end.
+`,
+		},
+		{
+			name: "repeat left by break",
+			src: `program test(input, output);
+var i: integer;
+var k: integer;
+begin
+  i := 0;
+  k := 0;
+  repeat
+    i := i + 1;
+    if i > 3 then
+      break;
+    k := k + i
+  until 1 = 0
+end.
+`,
+			want: []string{"12: Condition is always false [constant-condition]"},
+		},
+		{
+			name: "divisor that is not known",
+			src: `program test(input, output);
+procedure p(d: integer);
+var k: integer;
+begin
+  k := 10;
+  k := k div d;
+  if k > 0 then
+    p(k)
+end;
+begin
+  p(2)
+end.
+`,
+		},
+		{
+			name: "zero divisor",
+			src: `program test(input, output);
+procedure p(d: integer);
+var k: integer;
+var z: integer;
+begin
+  z := 0;
+  k := d div z;
+  if k > 0 then
+    p(k)
+end;
+begin
+  p(2)
+end.
+`,
+			want: []string{"7: Divisor z is always zero [division-by-zero]"},
+		},
+		{
+			name: "index out of bounds",
+			src: `program test(input, output);
+var a: array [1..10] of integer;
+procedure clear;
+var i: integer;
+begin
+  i := 0;
+  while i <= 10 do
+  begin
+    i := i + 1;
+    a[i] := 0
+  end
+end;
+begin
+  clear;
+  if a[1] = 0 then
+    clear
+end.
+`,
+			want: []string{"10: Array index i may be out of range 1..10, its value is in [1, 11] [index-range]"},
+		},
+		{
+			name: "overflow",
+			src: `program test(input, output);
+var i: integer;
+begin
+  i := 2147483600;
+  while i < 2147483647 do
+    i := i + 100
+end.
+`,
+			want: []string{"6: Value assigned to i may go above 2147483647, i is in [2147483600, 2147483646] before the assignment [overflow]"},
+		},
+		{
+			name: "unbounded counter",
+			src: `program test(input, output);
+var i: integer;
+begin
+  i := 0;
+  while 1 = 1 do
+    i := i + 1
+end.
+`,
+			want: []string{
+				"5: Condition is always true [constant-condition]",
+				"6: Value assigned to i may go above 2147483647, i is in [0, 2147483647] before the assignment [overflow]",
+			},
+		},
+		{
+			name: "counter of a loop that cannot be left",
+			src: `program test(input, output);
+var n: integer;
+begin
+  n := 0;
+  while n >= 0 do
+    n := n + 1
+end.
+`,
+			want: []string{"6: Value assigned to n may go above 2147483647, n is in [0, 2147483647] before the assignment [overflow]"},
+		},
+		{
+			name: "counter of an endless loop left by break",
+			src: `program test(input, output);
+var k: integer;
+begin
+  k := 0;
+  while 1 = 1 do
+  begin
+    k := k + 1;
+    if k > 100 then
+      break
+  end
+end.
+`,
+			want: []string{"5: Condition is always true [constant-condition]"},
+		},
+		{
+			name: "subrange overflow",
+			src: `program test(input, output);
+var g: integer;
+procedure p;
+var s: 1..10;
+begin
+  s := 1;
+  while s <= 10 do
+    s := s + 1;
+  g := s
+end;
+begin
+  p;
+  g := g + 1
+end.
+`,
+			want: []string{"8: Value assigned to s may go above 10, s is in [1, 10] before the assignment [overflow]"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compile(t, test.src, nil)
+			got := warnings(t)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("warnings = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCallGraph(t *testing.T) {
+	compile(t, `program test(input, output);
+var g: integer;
+procedure leaf;
+begin
+  g := g + 1
+end;
+procedure self(n: integer);
+begin
+  if n > 0 then
+    call self(n - 1);
+  call leaf
+end;
+procedure odd(n: integer); forward;
+procedure even(n: integer);
+begin
+  if n > 0 then
+    call odd(n - 1)
+end;
+procedure odd(n: integer);
+begin
+  if n > 0 then
+    call even(n - 1)
+end;
+procedure top;
+var big: real;
+begin
+  big := 1.0;
+  call leaf
+end;
+begin
+  g := 0;
+  call self(3);
+  call even(4);
+  call top
+end.
+`, func(parser *Parser) {
+		parser.SetCallGraph(true)
+	})
+
+	var graph struct {
+		Nodes []struct {
+			Name              string
+			DirectlyRecursive bool
+			MutuallyRecursive bool
+			Leaf              bool
+			StackDepth        int
+		}
+	}
+	if err := json.Unmarshal([]byte(output(t, "callgraph.json")), &graph); err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		direct, mutual, leaf bool
+		depth                int
+	}
+	want := map[string]summary{
+		"test":      {false, false, false, 24},
+		"test/leaf": {false, false, true, 8},
+		"test/self": {true, false, false, -1},
+		"test/odd":  {false, true, false, -1},
+		"test/even": {false, true, false, -1},
+		"test/top":  {false, false, false, 24},
+	}
+	for _, node := range graph.Nodes {
+		got := summary{node.DirectlyRecursive, node.MutuallyRecursive, node.Leaf, node.StackDepth}
+		if got != want[node.Name] {
+			t.Errorf("%s: got %+v, want %+v", node.Name, got, want[node.Name])
+		}
+		delete(want, node.Name)
+	}
+	if len(want) != 0 {
+		t.Errorf("call graph has no nodes for %v", want)
+	}
+}
+
+func TestCallGraphIsWrittenDespiteErrors(t *testing.T) {
+	compile(t, `program test(input, output);
+var g: integer;
+procedure p;
+begin
+  g := missing
+end;
+begin
+  p;
+  p
+end.
+`, func(parser *Parser) {
+		parser.SetCallGraph(true)
+	})
+
+	if errs := diagnostics(t); len(errs) == 0 {
+		t.Fatal("expected an error for the undeclared variable")
+	}
+	if dot := output(t, "callgraph.dot"); !strings.Contains(dot, `"test" -> "test/p" [label="8, 9"];`) {
+		t.Errorf("callgraph.dot has no edge from test to test/p:\n%s", dot)
+	}
+}
+
+func TestScopeGraph(t *testing.T) {
+	compile(t, nestedProgram, func(parser *Parser) {
+		parser.SetScopeGraph(true)
+	})
+
+	dot := output(t, "scope_tree.dot")
+	for _, want := range []string{
+		`"test" -> "test/outer";`,
+		`"test/outer" -> "test/outer/inner";`,
+		`<B>test/outer/inner</B> procedure, level 2, frame size 24`,
+		`<TD ALIGN="LEFT">+12</TD><TD ALIGN="LEFT">b</TD><TD ALIGN="LEFT">parameter</TD><TD ALIGN="LEFT">real</TD><TD ALIGN="RIGHT">8</TD>`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("scope_tree.dot has no %s:\n%s", want, dot)
+		}
+	}
+}
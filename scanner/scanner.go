@@ -38,6 +38,14 @@ func NewScanner() *Scanner {
 	return &scanner
 }
 
+// Fork returns a new scanner with the same reserved words and an empty
+// symbol table, for compiling another source file such as a unit.
+func (scanner *Scanner) Fork() *Scanner {
+	fork := NewScanner()
+	fork.res.Write(scanner.res.Bytes())
+	return fork
+}
+
 func (scanner *Scanner) Buffer() *Buffer {
 	return &scanner.buf
 }
@@ -100,7 +108,7 @@ func (scanner *Scanner) NextToken() (Token, error) {
 			return Token{}, err
 		}
 
-		if scanner.currentLength() > idLength {
+		if scanner.currentLength() > idLength && !scanner.isReservedPrefix(lexBuf.String()) {
 			return Token{}, LengthError
 		}
 
@@ -132,9 +140,16 @@ func (scanner *Scanner) NextToken() (Token, error) {
 					return NewToken(MULOP, DIV, lexBuf.String()), nil
 				}
 
+				if resToken == IN {
+					return NewToken(RELOP, IN, lexBuf.String()), nil
+				}
+
 				return NewToken(RES, resToken, lexBuf.String()), nil
 			} else {
 				str := lexBuf.String()
+				if len(str) > idLength {
+					return Token{}, LengthError
+				}
 
 				// sym := NewSymbol(str)
 				// add := scanner.symTable.AddSymbol(sym)
@@ -447,7 +462,7 @@ func (scanner *Scanner) NextToken() (Token, error) {
 			lexBuf.WriteString(currentChar)
 			scanner.advance()
 			scanner.commit()
-			return NewToken(MULOP, DIV, lexBuf.String()), nil
+			return NewToken(MULOP, REAL_DIV, lexBuf.String()), nil
 		}
 
 		break
@@ -493,6 +508,10 @@ func (scanner *Scanner) NextToken() (Token, error) {
 			scanner.advance()
 			scanner.commit()
 			return NewToken(RES, COLON, lexBuf.String()), nil
+		} else if currentChar == "^" {
+			scanner.advance()
+			scanner.commit()
+			return NewToken(RES, CARET, lexBuf.String()), nil
 		} else if currentChar == "." {
 			if scanner.peek() == "." {
 				lexBuf.WriteString(".")
@@ -639,6 +658,21 @@ func (scanner *Scanner) isReservedWord(word string) bool {
 	return false
 }
 
+// isReservedPrefix reports whether word is the start of a reserved word.
+// Reserved words may be longer than the identifier length limit.
+func (scanner *Scanner) isReservedPrefix(word string) bool {
+	reservedString := scanner.res.String()
+	reservedWords := strings.Split(reservedString, "\n")
+
+	for _, resWord := range reservedWords {
+		if strings.HasPrefix(resWord, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (scanner *Scanner) checkReservedWord(word string) AttributeType {
 	if word == "program" {
 		return PROG
@@ -720,5 +754,65 @@ func (scanner *Scanner) checkReservedWord(word string) AttributeType {
 		return CALL
 	}
 
+	if word == "record" {
+		return RECORD
+	}
+
+	if word == "for" {
+		return FOR
+	}
+
+	if word == "to" {
+		return TO
+	}
+
+	if word == "downto" {
+		return DOWNTO
+	}
+
+	if word == "repeat" {
+		return REPEAT
+	}
+
+	if word == "until" {
+		return UNTIL
+	}
+
+	if word == "case" {
+		return CASE
+	}
+
+	if word == "type" {
+		return TYPE
+	}
+
+	if word == "nil" {
+		return NIL
+	}
+
+	if word == "unit" {
+		return UNIT
+	}
+
+	if word == "uses" {
+		return USES
+	}
+
+	if word == "interface" {
+		return INTERFACE
+	}
+
+	if word == "implementation" {
+		return IMPLEMENTATION
+	}
+
+	if word == "set" {
+		return SET
+	}
+
+	if word == "in" {
+		return IN
+	}
+
 	return NULL
 }
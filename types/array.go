@@ -0,0 +1,31 @@
+package types
+
+import "fmt"
+
+// Array is a one-dimensional array indexed by the values Low through
+// High of the ordinal type Index.
+type Array struct {
+	Low   int
+	High  int
+	Index Type
+	Elem  Type
+}
+
+func NewArray(low int, high int, index Type, elem Type) *Array {
+	return &Array{low, high, index, elem}
+}
+
+// Length returns the number of elements in the array.
+func (array *Array) Length() int {
+	return array.High - array.Low + 1
+}
+
+func (array *Array) String() string {
+	low := OrdinalString(array.Index, array.Low)
+	high := OrdinalString(array.Index, array.High)
+	return fmt.Sprintf("array[%s..%s] of %s", low, high, array.Elem)
+}
+
+func (array *Array) Size() int {
+	return array.Length() * array.Elem.Size()
+}
@@ -0,0 +1,30 @@
+package types
+
+// Basic is a predeclared scalar type such as integer or real.
+type Basic struct {
+	name string
+	size int
+}
+
+var (
+	Integer = &Basic{"integer", 4}
+	Real    = &Basic{"real", 8}
+	Boolean = &Basic{"boolean", 1}
+	Nil     = &Basic{"nil", 4}
+	Invalid = &Basic{"invalid", 0}
+)
+
+// MinInteger and MaxInteger are the smallest and largest values of an
+// integer, which is stored in 32 bits.
+const (
+	MinInteger = -1 << 31
+	MaxInteger = 1<<31 - 1
+)
+
+func (basic *Basic) String() string {
+	return basic.name
+}
+
+func (basic *Basic) Size() int {
+	return basic.size
+}
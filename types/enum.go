@@ -0,0 +1,32 @@
+package types
+
+import "strings"
+
+// Enum is an enumerated type. Its values are the ordinals 0 through
+// len(Names)-1, in declaration order. Two enumerated types are only
+// identical if they come from the same declaration.
+type Enum struct {
+	Name  string
+	Names []string
+}
+
+func NewEnum() *Enum {
+	return &Enum{"", make([]string, 0)}
+}
+
+// AddName appends an enumerator and returns its ordinal value.
+func (enum *Enum) AddName(name string) int {
+	enum.Names = append(enum.Names, name)
+	return len(enum.Names) - 1
+}
+
+func (enum *Enum) String() string {
+	if enum.Name != "" {
+		return enum.Name
+	}
+	return "(" + strings.Join(enum.Names, ", ") + ")"
+}
+
+func (enum *Enum) Size() int {
+	return 4
+}
@@ -0,0 +1,29 @@
+package types
+
+// OpenArray is the type of an open array parameter, declared as
+// "array of T". It accepts an array of any length whose elements are of
+// type Elem, indexed from 0 to high(a). An open array is passed as the
+// address of the array followed by a hidden integer argument holding the
+// highest index.
+type OpenArray struct {
+	Elem Type
+}
+
+func NewOpenArray(elem Type) *OpenArray {
+	return &OpenArray{elem}
+}
+
+func (array *OpenArray) String() string {
+	return "array of " + array.Elem.String()
+}
+
+// Size is the size of the address of the array. The hidden bound
+// argument takes another BoundSize bytes.
+func (array *OpenArray) Size() int {
+	return 4
+}
+
+// BoundSize is the size of the hidden argument holding high(a).
+func (array *OpenArray) BoundSize() int {
+	return Integer.Size()
+}
@@ -0,0 +1,22 @@
+package types
+
+// Pointer is a pointer to a value of type Elem. Pointer types always
+// name their base type, so Name is kept for printing; printing Elem would
+// not terminate for a record that points to itself. Elem is nil until a
+// pointer declared ahead of its base type is resolved.
+type Pointer struct {
+	Name string
+	Elem Type
+}
+
+func NewPointer(name string, elem Type) *Pointer {
+	return &Pointer{name, elem}
+}
+
+func (pointer *Pointer) String() string {
+	return "^" + pointer.Name
+}
+
+func (pointer *Pointer) Size() int {
+	return 4
+}
@@ -0,0 +1,35 @@
+package types
+
+import "strings"
+
+// Param is a single formal parameter of a procedure.
+type Param struct {
+	Name string
+	Type Type
+}
+
+// Procedure describes the signature of a procedure. Procedures
+// occupy no storage of their own.
+type Procedure struct {
+	Params []*Param
+}
+
+func NewProcedure() *Procedure {
+	return &Procedure{make([]*Param, 0)}
+}
+
+func (proc *Procedure) AddParam(name string, typ Type) {
+	proc.Params = append(proc.Params, &Param{name, typ})
+}
+
+func (proc *Procedure) String() string {
+	params := make([]string, len(proc.Params))
+	for i, param := range proc.Params {
+		params[i] = param.Name + ": " + param.Type.String()
+	}
+	return "procedure(" + strings.Join(params, "; ") + ")"
+}
+
+func (proc *Procedure) Size() int {
+	return 0
+}
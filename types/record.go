@@ -0,0 +1,59 @@
+package types
+
+import "strings"
+
+// Field is a named member of a record. Offset is the distance in bytes
+// from the start of the record.
+type Field struct {
+	Name   string
+	Type   Type
+	Offset int
+}
+
+// Record is a record type with fields laid out in declaration order.
+type Record struct {
+	Fields []*Field
+	size   int
+}
+
+func NewRecord() *Record {
+	return &Record{make([]*Field, 0), 0}
+}
+
+// AddField appends a field to the end of the record, placed on the
+// field type's alignment. It returns false if a field with the same name
+// already exists.
+func (record *Record) AddField(name string, typ Type) bool {
+	if record.Field(name) != nil {
+		return false
+	}
+
+	offset := alignUp(record.size, Align(typ))
+	record.Fields = append(record.Fields, &Field{name, typ, offset})
+	record.size = offset + typ.Size()
+	return true
+}
+
+// Field returns the field called name, or nil if there is none.
+func (record *Record) Field(name string) *Field {
+	for _, field := range record.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func (record *Record) String() string {
+	fields := make([]string, len(record.Fields))
+	for i, field := range record.Fields {
+		fields[i] = field.Name + ": " + field.Type.String()
+	}
+	return "record " + strings.Join(fields, "; ") + " end"
+}
+
+// Size includes the padding after the last field that keeps the
+// fields aligned in an array of records.
+func (record *Record) Size() int {
+	return alignUp(record.size, Align(record))
+}
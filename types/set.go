@@ -0,0 +1,28 @@
+package types
+
+// MaxSetElem is the largest ordinal value a set can hold. Sets are stored
+// as a single 64 bit word with one bit per value.
+const MaxSetElem = 63
+
+// Set is a set of values of the ordinal type Elem. The empty set
+// constructor [] has a nil Elem and is compatible with every set.
+type Set struct {
+	Elem Type
+}
+
+var EmptySet = &Set{nil}
+
+func NewSet(elem Type) *Set {
+	return &Set{elem}
+}
+
+func (set *Set) String() string {
+	if set.Elem == nil {
+		return "set of []"
+	}
+	return "set of " + set.Elem.String()
+}
+
+func (set *Set) Size() int {
+	return (MaxSetElem + 1) / 8
+}
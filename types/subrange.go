@@ -0,0 +1,25 @@
+package types
+
+// Subrange is a contiguous range of values of an integer or
+// enumerated base type.
+type Subrange struct {
+	Name string
+	Low  int
+	High int
+	Base Type
+}
+
+func NewSubrange(low int, high int, base Type) *Subrange {
+	return &Subrange{"", low, high, base}
+}
+
+func (subrange *Subrange) String() string {
+	if subrange.Name != "" {
+		return subrange.Name
+	}
+	return OrdinalString(subrange.Base, subrange.Low) + ".." + OrdinalString(subrange.Base, subrange.High)
+}
+
+func (subrange *Subrange) Size() int {
+	return subrange.Base.Size()
+}
@@ -0,0 +1,265 @@
+package types
+
+import "strconv"
+
+// Type is implemented by every type the compiler knows about.
+// Size reports the number of bytes a value of the type occupies.
+type Type interface {
+	String() string
+	Size() int
+}
+
+// Identical reports whether two types are structurally the same.
+// Arrays are only identical when their bounds and element types match,
+// and records when their fields have the same names and types. Pointers
+// are identical when they point to the same type; comparing their base
+// types structurally would not terminate for recursive records.
+func Identical(x Type, y Type) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+
+	switch a := x.(type) {
+	case *Array:
+		b, ok := y.(*Array)
+		if !ok {
+			return false
+		}
+		return a.Low == b.Low && a.High == b.High && Identical(a.Index, b.Index) && Identical(a.Elem, b.Elem)
+	case *Subrange:
+		b, ok := y.(*Subrange)
+		if !ok {
+			return false
+		}
+		return a.Low == b.Low && a.High == b.High && Identical(a.Base, b.Base)
+	case *Record:
+		b, ok := y.(*Record)
+		if !ok || len(a.Fields) != len(b.Fields) {
+			return false
+		}
+		for i := range a.Fields {
+			if a.Fields[i].Name != b.Fields[i].Name || !Identical(a.Fields[i].Type, b.Fields[i].Type) {
+				return false
+			}
+		}
+		return true
+	case *OpenArray:
+		b, ok := y.(*OpenArray)
+		return ok && Identical(a.Elem, b.Elem)
+	case *Set:
+		b, ok := y.(*Set)
+		return ok && Identical(a.Elem, b.Elem)
+	case *Pointer:
+		b, ok := y.(*Pointer)
+		return ok && a.Elem == b.Elem
+	case *Procedure:
+		b, ok := y.(*Procedure)
+		if !ok || len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !Identical(a.Params[i].Type, b.Params[i].Type) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return x == y
+}
+
+// Base returns the type a subrange was taken from. Any other type is
+// its own base.
+func Base(t Type) Type {
+	if subrange, ok := t.(*Subrange); ok {
+		return subrange.Base
+	}
+	return t
+}
+
+// IsInteger reports whether t is integer or a subrange of integer.
+func IsInteger(t Type) bool {
+	return Base(t) == Integer
+}
+
+func IsReal(t Type) bool {
+	return t == Real
+}
+
+func IsBoolean(t Type) bool {
+	return t == Boolean
+}
+
+// IsNumeric reports whether arithmetic and relational operators apply to t.
+func IsNumeric(t Type) bool {
+	return IsInteger(t) || IsReal(t)
+}
+
+// AssignableTo reports whether a value of type value can be stored in a
+// variable or passed to a parameter of type target. Integers are
+// promoted to reals, ordinal values are compatible with subranges of
+// the same base type, nil can be stored in any pointer, sets are
+// compatible when their elements are, and an open array accepts any
+// array with the same element type.
+func AssignableTo(value Type, target Type) bool {
+	if IsInteger(value) && IsReal(target) {
+		return true
+	}
+	if open, ok := target.(*OpenArray); ok {
+		switch array := value.(type) {
+		case *Array:
+			return Identical(array.Elem, open.Elem)
+		case *OpenArray:
+			return Identical(array.Elem, open.Elem)
+		}
+		return false
+	}
+	if IsSet(value) && IsSet(target) {
+		return SetsCompatible(value, target)
+	}
+	if value == Nil && IsPointer(target) {
+		return true
+	}
+	if IsOrdinal(value) && IsOrdinal(target) {
+		return Identical(Base(value), Base(target))
+	}
+	return Identical(value, target)
+}
+
+// Comparable reports whether the relational operators apply to a pair
+// of operands: two numbers, or two ordinals of the same base type.
+func Comparable(x Type, y Type) bool {
+	if IsNumeric(x) && IsNumeric(y) {
+		return true
+	}
+	return IsOrdinal(x) && IsOrdinal(y) && Identical(Base(x), Base(y))
+}
+
+// Equatable reports whether "=" and "<>" apply to a pair of pointer
+// operands: two pointers to the same type, or a pointer and nil.
+func Equatable(x Type, y Type) bool {
+	if !IsPointer(x) && !IsPointer(y) {
+		return false
+	}
+	return AssignableTo(x, y) || AssignableTo(y, x)
+}
+
+// IsSet reports whether t is a set type.
+func IsSet(t Type) bool {
+	_, ok := t.(*Set)
+	return ok
+}
+
+// SetsCompatible reports whether two set types can be combined with the
+// set operators: their elements have the same base type, or one of them
+// is the empty set.
+func SetsCompatible(x Type, y Type) bool {
+	a, ok := x.(*Set)
+	if !ok {
+		return false
+	}
+	b, ok := y.(*Set)
+	if !ok {
+		return false
+	}
+	if a.Elem == nil || b.Elem == nil {
+		return true
+	}
+	return Identical(Base(a.Elem), Base(b.Elem))
+}
+
+// IsPointer reports whether t is a pointer type.
+func IsPointer(t Type) bool {
+	_, ok := t.(*Pointer)
+	return ok
+}
+
+// Arithmetic returns the type of an arithmetic operation on two numeric
+// operands. Mixing an integer with a real promotes the integer.
+func Arithmetic(left Type, right Type) Type {
+	if IsReal(left) || IsReal(right) {
+		return Real
+	}
+	return Integer
+}
+
+// IsOrdinal reports whether values of t can be counted, which makes
+// them usable as case selectors and labels, array indices and subrange
+// bounds.
+func IsOrdinal(t Type) bool {
+	switch Base(t).(type) {
+	case *Enum:
+		return true
+	}
+	return IsInteger(t) || IsBoolean(t)
+}
+
+// Bounds returns the smallest and largest values of an enumerated or
+// subrange type. The last result is false for types without fixed
+// bounds, such as integer.
+func Bounds(t Type) (int, int, bool) {
+	switch b := t.(type) {
+	case *Subrange:
+		return b.Low, b.High, true
+	case *Enum:
+		return 0, len(b.Names) - 1, true
+	}
+	return 0, 0, false
+}
+
+// OrdinalString formats the ordinal value n of type t, using the name
+// of the enumerator when t is enumerated.
+func OrdinalString(t Type, n int) string {
+	if enum, ok := Base(t).(*Enum); ok && n >= 0 && n < len(enum.Names) {
+		return enum.Names[n]
+	}
+	return strconv.Itoa(n)
+}
+
+// IsInvalid reports whether t is the result of an earlier error. Checks
+// against an invalid type should be skipped to avoid cascading errors.
+func IsInvalid(t Type) bool {
+	return t == Invalid
+}
+
+// Align returns the boundary in bytes a variable of type t is placed
+// on. Arrays and subranges are aligned like their elements and base
+// type, records like their most strictly aligned field, and everything
+// else on its own size up to 8 bytes.
+func Align(t Type) int {
+	if t == nil {
+		return 1
+	}
+
+	switch typ := t.(type) {
+	case *Array:
+		return Align(typ.Elem)
+	case *Subrange:
+		return Align(typ.Base)
+	case *Record:
+		align := 1
+		for _, field := range typ.Fields {
+			if a := Align(field.Type); a > align {
+				align = a
+			}
+		}
+		return align
+	}
+
+	switch size := t.Size(); {
+	case size >= 8:
+		return 8
+	case size >= 4:
+		return 4
+	case size >= 2:
+		return 2
+	}
+	return 1
+}
+
+func alignUp(n int, align int) int {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
@@ -0,0 +1,200 @@
+package util
+
+import "compiler/types"
+
+// Frame layout constants. The stack grows towards lower addresses and is
+// addressed through a frame pointer. Arguments are pushed in whole words
+// and every frame is a multiple of stackAlign bytes.
+const (
+	wordSize   = 4
+	stackAlign = 8
+
+	// Offsets of the link area from the frame pointer.
+	savedFPOffset     = 0
+	returnAddrOffset  = 4
+	staticLinkOffset  = 8
+	firstParamOffset  = 8
+	nestedParamOffset = 12
+)
+
+// Slot is the storage of one parameter or variable. Offset is relative
+// to the frame pointer for a procedure and to the start of the data area
+// for the program or a unit.
+type Slot struct {
+	Name   string
+	Kind   string
+	Type   string
+	Offset int
+	Size   int
+	Align  int
+	typ    types.Type
+}
+
+// Frame is the activation record of a procedure, or the data area of
+// the program or a unit, which is allocated statically.
+//
+// A procedure's frame holds, from higher to lower addresses, its
+// arguments, the static link when the procedure is nested in another
+// procedure, the return address, the caller's frame pointer, which the
+// frame pointer points to, and its local variables. Arguments are at
+// positive offsets and locals at negative ones. StaticLink is 0 when the
+// procedure has no static link.
+//
+// Size is the size of the whole record, rounded to the stack alignment.
+// It includes the ParamSize bytes of arguments, which the caller pushes
+// before the call, and the link area; the procedure itself allocates
+// only LocalSize bytes below its frame pointer.
+type Frame struct {
+	Name          string
+	Kind          string
+	Level         int
+	Static        bool
+	Params        []*Slot
+	Locals        []*Slot
+	SavedFP       int
+	ReturnAddress int
+	StaticLink    int
+	ParamSize     int
+	LocalSize     int
+	Size          int
+	node          *GreenNode
+}
+
+// NewFrame lays out the activation record of node.
+func NewFrame(node *GreenNode) *Frame {
+	frame := &Frame{Name: node.Path(), node: node}
+	if node.sym != nil {
+		frame.Kind = node.sym.kind.String()
+	}
+
+	for scope := node; scope.IsProcedure(); scope = scope.parent {
+		frame.Level++
+	}
+
+	if !node.IsProcedure() {
+		frame.Static = true
+		frame.layoutStatic()
+		return frame
+	}
+
+	frame.SavedFP = savedFPOffset
+	frame.ReturnAddress = returnAddrOffset
+	link := firstParamOffset
+	if node.parent.IsProcedure() {
+		frame.StaticLink = staticLinkOffset
+		link = nestedParamOffset
+	}
+
+	frame.layoutParams(link)
+	frame.layoutLocals()
+	frame.Size = alignUp(link+frame.ParamSize+frame.LocalSize, stackAlign)
+	return frame
+}
+
+// Frames lays out the activation records of node and of every procedure
+// nested in it, outermost first.
+func (node *GreenNode) Frames() []*Frame {
+	frames := []*Frame{NewFrame(node)}
+	for _, greenNode := range node.children {
+		frames = append(frames, greenNode.Frames()...)
+	}
+	return frames
+}
+
+// IsProcedure reports whether node is the scope of a procedure rather
+// than of the program or a unit.
+func (node *GreenNode) IsProcedure() bool {
+	return node != nil && node.sym != nil && node.sym.kind == ProcedureSym
+}
+
+// Node returns the scope the frame was laid out for.
+func (frame *Frame) Node() *GreenNode {
+	return frame.node
+}
+
+// layoutStatic places the variables of the program or a unit one after
+// the other from offset 0, each on its own alignment.
+func (frame *Frame) layoutStatic() {
+	offset := 0
+	for _, blueNode := range frame.node.vars {
+		if blueNode.sym.kind != VariableSym {
+			continue
+		}
+
+		slot := newSlot(blueNode)
+		slot.Offset = alignUp(offset, slot.Align)
+		offset = slot.Offset + slot.Size
+		frame.Locals = append(frame.Locals, slot)
+	}
+
+	frame.LocalSize = offset
+	frame.Size = offset
+}
+
+// layoutParams places the arguments upwards from offset in declaration
+// order, each in a whole number of words, so an argument is aligned on
+// a word whatever its type. An open array is passed as its address
+// followed by a hidden argument holding its upper bound.
+func (frame *Frame) layoutParams(offset int) {
+	start := offset
+	for _, blueNode := range frame.node.vars {
+		if blueNode.sym.kind != ParameterSym {
+			continue
+		}
+
+		slot := newSlot(blueNode)
+		slot.Offset = offset
+		slot.Align = wordSize
+		offset += alignUp(slot.Size, wordSize)
+		frame.Params = append(frame.Params, slot)
+
+		if open, ok := slot.typ.(*types.OpenArray); ok {
+			bound := open.BoundSize()
+			high := &Slot{"high(" + slot.Name + ")", slot.Kind, types.Integer.String(), offset, bound, wordSize, types.Integer}
+			offset += alignUp(bound, wordSize)
+			frame.Params = append(frame.Params, high)
+		}
+	}
+
+	frame.ParamSize = offset - start
+}
+
+// layoutLocals places the local variables downwards from the frame
+// pointer, each on its own alignment, and rounds the space they take up
+// to the stack alignment.
+func (frame *Frame) layoutLocals() {
+	size := 0
+	for _, blueNode := range frame.node.vars {
+		if blueNode.sym.kind != VariableSym {
+			continue
+		}
+
+		slot := newSlot(blueNode)
+		size = alignUp(size+slot.Size, slot.Align)
+		slot.Offset = -size
+		frame.Locals = append(frame.Locals, slot)
+	}
+
+	frame.LocalSize = alignUp(size, stackAlign)
+}
+
+func newSlot(blueNode *BlueNode) *Slot {
+	typ := blueNode.sym.GetType()
+	slot := &Slot{Name: blueNode.name, Kind: blueNode.sym.kind.String(), Size: blueNode.size, Align: types.Align(typ), typ: typ}
+	if typ != nil {
+		slot.Type = typ.String()
+	}
+	return slot
+}
+
+// GetType returns the type of the parameter or variable in the slot.
+func (slot *Slot) GetType() types.Type {
+	return slot.typ
+}
+
+func alignUp(n int, align int) int {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
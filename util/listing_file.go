@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -9,19 +10,71 @@ import (
 
 // listingFile is a structure for the creation and saving of
 // a source code file during lexical analysis.
+//
+// Errors are written as they are found, after the source line they
+// belong to. Warnings come from analyses that run once the whole file
+// has been parsed, so they are kept by line and merged in by Save.
 type ListingFile struct {
 	Buffer
-	counter int
+	counter    int
+	errors     int
+	starts     []int
+	warnings   map[int][]string
+	count      int
+	suppressed map[WarningKind]bool
+}
+
+// WarningKind is a category of warning. Each category can be suppressed
+// on its own.
+type WarningKind uint
+
+const (
+	Uninitialized WarningKind = iota
+	Unused
+	Uncalled
+	DeadAssignment
+	Unreachable
+	ConstantCondition
+	IndexRange
+	DivisionByZero
+	Overflow
+)
+
+var WarningStrings map[WarningKind]string = map[WarningKind]string{
+	Uninitialized:     "uninitialized",
+	Unused:            "unused",
+	Uncalled:          "uncalled",
+	DeadAssignment:    "dead-assignment",
+	Unreachable:       "unreachable",
+	ConstantCondition: "constant-condition",
+	IndexRange:        "index-range",
+	DivisionByZero:    "division-by-zero",
+	Overflow:          "overflow",
+}
+
+// ParseWarningKind returns the warning category called name.
+func ParseWarningKind(name string) (WarningKind, error) {
+	for kind, str := range WarningStrings {
+		if str == name {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown warning %s", name)
+}
+
+func (kind WarningKind) String() string {
+	return WarningStrings[kind]
 }
 
 func NewListingFile() *ListingFile {
-	return new(ListingFile)
+	return &ListingFile{warnings: make(map[int][]string), suppressed: make(map[WarningKind]bool)}
 }
 
 // AddLine adds a line from the source code to the listing file.
 // It adds a line number at the beginning.
 func (listing *ListingFile) AddLine(line string) error {
 	lineNumber := strconv.Itoa(listing.counter + 1)
+	listing.starts = append(listing.starts, listing.Len())
 	_, err := listing.WriteString(lineNumber + ": " + strings.Trim(line, "0x00") + "\n")
 	listing.counter += 1
 	return err
@@ -30,30 +83,61 @@ func (listing *ListingFile) AddLine(line string) error {
 // AddError adds a line to the listing file describing an error.
 // It adds "LEXERR" to the front of the error.
 func (listing *ListingFile) AddLexError(line string) error {
+	listing.errors++
 	_, err := listing.WriteString("Lexical Error: " + line + "\n")
 	return err
 }
 
 func (listing *ListingFile) AddSyntaxError(line string) error {
+	listing.errors++
 	_, err := listing.WriteString("Syntax Error: " + line + "\n")
 	return err
 }
 
 func (listing *ListingFile) AddSemanticError(line string) error {
+	listing.errors++
 	_, err := listing.WriteString("Semantic Error: " + line + "\n")
 	return err
 }
 
 func (listing *ListingFile) AddTypeError(line string) error {
+	listing.errors++
 	_, err := listing.WriteString("Type Error: " + line + "\n")
 	return err
 }
 
 func (listing *ListingFile) AddScopeError(line string) error {
+	listing.errors++
 	_, err := listing.WriteString("Scope Error: " + line + "\n")
 	return err
 }
 
+// Suppress turns off warnings of the given kind.
+func (listing *ListingFile) Suppress(kind WarningKind) {
+	listing.suppressed[kind] = true
+}
+
+// AddWarning adds a warning about source line line, unless warnings of
+// its kind are suppressed. It is listed after the errors on that line.
+func (listing *ListingFile) AddWarning(line int, kind WarningKind, msg string) {
+	if listing.suppressed[kind] {
+		return
+	}
+
+	listing.warnings[line] = append(listing.warnings[line], "Warning: "+msg+" ["+kind.String()+"]\n")
+	listing.count++
+}
+
+// WarningCount returns the number of warnings added to the listing.
+func (listing *ListingFile) WarningCount() int {
+	return listing.count
+}
+
+// ErrorCount returns the number of errors added to the listing.
+func (listing *ListingFile) ErrorCount() int {
+	return listing.errors
+}
+
 func (listing *ListingFile) LineCount() int {
 	return listing.counter
 }
@@ -69,6 +153,32 @@ func (listing *ListingFile) Save() string {
 	}
 	defer newFile.Close()
 
-	newFile.Write(listing.Bytes())
+	newFile.Write(listing.merged())
 	return file
 }
+
+// merged returns the listing with each warning inserted before the
+// source line that follows the one it is about.
+func (listing *ListingFile) merged() []byte {
+	data := listing.Bytes()
+	if listing.count == 0 {
+		return data
+	}
+
+	var out []byte
+	prev := 0
+	for line := 1; line <= len(listing.starts); line++ {
+		end := len(data)
+		if line < len(listing.starts) {
+			end = listing.starts[line]
+		}
+
+		out = append(out, data[prev:end]...)
+		for _, warning := range listing.warnings[line] {
+			out = append(out, warning...)
+		}
+		prev = end
+	}
+
+	return append(out, data[prev:]...)
+}
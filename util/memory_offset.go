@@ -1,17 +1,102 @@
 package util
 
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "io/ioutil"
 import "os"
+import "strconv"
+import "text/tabwriter"
+import "compiler/types"
 
+// MemoryOffsetList is the frame layout report. It is written as text to
+// memory_offsets.txt and as JSON, for use by a code generator, to
+// memory_offsets.json.
 type MemoryOffsetList struct {
-	buffer Buffer
+	Frames []*Frame
 }
 
 func NewMemoryOffsetList() *MemoryOffsetList {
 	return new(MemoryOffsetList)
 }
 
-func (mol *MemoryOffsetList) AddOffset(name string, offset string) {
-	mol.buffer.WriteString(name + " " + offset + "\n")
+func (mol *MemoryOffsetList) AddFrames(frames []*Frame) {
+	mol.Frames = append(mol.Frames, frames...)
+}
+
+func (mol *MemoryOffsetList) String() string {
+	var buf bytes.Buffer
+
+	for _, frame := range mol.Frames {
+		if frame.Static {
+			fmt.Fprintf(&buf, "%s %s: data size %d\n", frame.Kind, frame.Name, frame.Size)
+		} else {
+			fmt.Fprintf(&buf, "%s %s: level %d, frame size %d\n", frame.Kind, frame.Name, frame.Level, frame.Size)
+		}
+
+		w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+		params := frame.Params
+		for i := len(params) - 1; i >= 0; i-- {
+			writeSlot(w, params[i])
+			if record, ok := params[i].typ.(*types.Record); ok {
+				writeFields(w, params[i], params[i].Name, record, params[i].Offset)
+			}
+		}
+
+		if !frame.Static {
+			if frame.StaticLink != 0 {
+				fmt.Fprintf(w, "%6s  static link\t\t%d\n", "+"+strconv.Itoa(frame.StaticLink), wordSize)
+			}
+			fmt.Fprintf(w, "%6s  return address\t\t%d\n", "+"+strconv.Itoa(frame.ReturnAddress), wordSize)
+			fmt.Fprintf(w, "%6d  saved frame pointer\t\t%d\n", frame.SavedFP, wordSize)
+		}
+
+		for _, slot := range frame.Locals {
+			writeSlot(w, slot)
+			if record, ok := slot.typ.(*types.Record); ok {
+				writeFields(w, slot, slot.Name, record, slot.Offset)
+			}
+		}
+
+		w.Flush()
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+func writeSlot(w *tabwriter.Writer, slot *Slot) {
+	fmt.Fprintf(w, "%6s  %s\t%s\t%d\n", slotOffset(slot), slot.Name, slot.Type, slot.Size)
+}
+
+// slotOffset formats the offset of slot, with a plus sign for the
+// arguments above the frame pointer.
+func slotOffset(slot *Slot) string {
+	return formatOffset(slot, slot.Offset)
+}
+
+// formatOffset formats offset, an offset within slot, with a plus sign
+// for the arguments above the frame pointer.
+func formatOffset(slot *Slot, offset int) string {
+	text := strconv.Itoa(offset)
+	if offset > 0 && slot.Kind == ParameterSym.String() {
+		text = "+" + text
+	}
+	return text
+}
+
+// writeFields lists the offset of every field in a record variable or
+// argument, held in slot, that starts at base, descending into nested
+// records.
+func writeFields(w *tabwriter.Writer, slot *Slot, prefix string, record *types.Record, base int) {
+	for _, field := range record.Fields {
+		fieldName := prefix + "." + field.Name
+		fmt.Fprintf(w, "%6s  %s\t%s\t%d\n", formatOffset(slot, base+field.Offset), fieldName, field.Type, field.Type.Size())
+
+		if nested, ok := field.Type.(*types.Record); ok {
+			writeFields(w, slot, fieldName, nested, base+field.Offset)
+		}
+	}
 }
 
 func (mol *MemoryOffsetList) WriteMemoryOffsetFile() {
@@ -19,5 +104,10 @@ func (mol *MemoryOffsetList) WriteMemoryOffsetFile() {
 	newFile, _ := os.Create(file)
 	defer newFile.Close()
 
-	newFile.Write(mol.buffer.Bytes())
+	newFile.WriteString(mol.String())
+
+	data, err := json.MarshalIndent(mol, "", "\t")
+	if err == nil {
+		ioutil.WriteFile("memory_offsets.json", data, 0644)
+	}
 }
@@ -0,0 +1,88 @@
+package util
+
+import "bytes"
+import "fmt"
+import "html"
+import "io/ioutil"
+import "strconv"
+
+// Dot returns the scope tree below node in the Graphviz DOT language,
+// ready to be rendered with dot -Tsvg. Each scope is drawn as a table of
+// its activation record: the arguments, the link area and the local
+// variables with their offsets, types and sizes, highest address first,
+// followed by the types declared in the scope. An edge joins each scope
+// to the procedures nested in it.
+func (node *GreenNode) Dot() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "digraph %s {\n", strconv.Quote(node.Path()))
+	buf.WriteString("\tnode [shape=plaintext, fontname=\"monospace\"];\n")
+	frames := node.Frames()
+	for _, frame := range frames {
+		fmt.Fprintf(&buf, "\t%s [label=<%s>];\n", strconv.Quote(frame.Name), frame.dotTable())
+	}
+	for _, frame := range frames {
+		for _, child := range frame.node.children {
+			fmt.Fprintf(&buf, "\t%s -> %s;\n", strconv.Quote(frame.Name), strconv.Quote(child.Path()))
+		}
+	}
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// WriteDot writes the scope tree below node to scope_tree.dot.
+func (node *GreenNode) WriteDot() {
+	ioutil.WriteFile("scope_tree.dot", []byte(node.Dot()), 0644)
+}
+
+// dotTable returns the HTML-like label of the frame's node.
+func (frame *Frame) dotTable() string {
+	var buf bytes.Buffer
+
+	buf.WriteString(`<TABLE BORDER="0" CELLBORDER="1" CELLSPACING="0" CELLPADDING="3">`)
+	title := "<B>" + html.EscapeString(frame.Name) + "</B> " + frame.Kind
+	if frame.Static {
+		title += ", data size " + strconv.Itoa(frame.Size)
+	} else {
+		title += ", level " + strconv.Itoa(frame.Level) + ", frame size " + strconv.Itoa(frame.Size)
+	}
+	fmt.Fprintf(&buf, `<TR><TD COLSPAN="5" BGCOLOR="lightgrey">%s</TD></TR>`, title)
+	buf.WriteString("<TR><TD><I>offset</I></TD><TD><I>name</I></TD><TD><I>kind</I></TD><TD><I>type</I></TD><TD><I>size</I></TD></TR>")
+
+	for i := len(frame.Params) - 1; i >= 0; i-- {
+		writeDotRow(&buf, "", slotOffset(frame.Params[i]), frame.Params[i].Name, frame.Params[i].Kind, frame.Params[i].Type, frame.Params[i].Size)
+	}
+	if !frame.Static {
+		if frame.StaticLink != 0 {
+			writeDotRow(&buf, "whitesmoke", "+"+strconv.Itoa(frame.StaticLink), "static link", "", "", wordSize)
+		}
+		writeDotRow(&buf, "whitesmoke", "+"+strconv.Itoa(frame.ReturnAddress), "return address", "", "", wordSize)
+		writeDotRow(&buf, "whitesmoke", strconv.Itoa(frame.SavedFP), "saved frame pointer", "", "", wordSize)
+	}
+	for _, slot := range frame.Locals {
+		writeDotRow(&buf, "", slotOffset(slot), slot.Name, slot.Kind, slot.Type, slot.Size)
+	}
+
+	for _, blueNode := range frame.node.vars {
+		sym := blueNode.sym
+		if sym.kind == TypeSym && sym.typeName != nil {
+			writeDotRow(&buf, "", "", sym.name, sym.kind.String(), sym.typeName.String(), sym.typeName.Size())
+		}
+	}
+
+	buf.WriteString("</TABLE>")
+	return buf.String()
+}
+
+func writeDotRow(buf *bytes.Buffer, color string, offset string, name string, kind string, typeName string, size int) {
+	if color != "" {
+		fmt.Fprintf(buf, `<TR BGCOLOR="%s">`, color)
+	} else {
+		buf.WriteString("<TR>")
+	}
+	for _, cell := range []string{offset, name, kind, typeName} {
+		fmt.Fprintf(buf, `<TD ALIGN="LEFT">%s</TD>`, html.EscapeString(cell))
+	}
+	fmt.Fprintf(buf, `<TD ALIGN="RIGHT">%d</TD></TR>`, size)
+}
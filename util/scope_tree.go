@@ -1,20 +1,27 @@
 package util
 
 import "fmt"
-import "strconv"
+import "compiler/types"
 
 type ScopeTree struct {
 	root  *GreenNode
 	stack *Stack
 }
 
+// GreenNode is a scope: the program, a unit or a procedure. Names
+// declared in the scope are kept in declaration order in vars and
+// children, and indexed by name in symbols and procs so that a lookup
+// in one scope takes constant time.
 type GreenNode struct {
 	name     string
 	sym      *Symbol
 	parent   *GreenNode
 	vars     []*BlueNode
+	symbols  map[string]*BlueNode
 	children []*GreenNode
+	procs    map[string]*GreenNode
 	params   int
+	forward  bool
 }
 
 type BlueNode struct {
@@ -29,7 +36,14 @@ func NewScopeTree() *ScopeTree {
 }
 
 func NewGreenNode(name string, sym *Symbol) *GreenNode {
-	return &GreenNode{name: name, sym: sym, vars: make([]*BlueNode, 0), children: make([]*GreenNode, 0)}
+	return &GreenNode{
+		name:     name,
+		sym:      sym,
+		vars:     make([]*BlueNode, 0),
+		symbols:  make(map[string]*BlueNode),
+		children: make([]*GreenNode, 0),
+		procs:    make(map[string]*GreenNode),
+	}
 }
 
 func NewBlueNode(name string, sym *Symbol, size int) *BlueNode {
@@ -54,34 +68,31 @@ func (scope *ScopeTree) GetRoot() *GreenNode {
 	return scope.root
 }
 
-func (node *GreenNode) GetMemoryOffset(list *MemoryOffsetList) {
-	list.AddOffset(node.name, "FFFFFFFF")
-	runningTotal := 0
-
-	for _, blueNode := range node.vars {
-		if blueNode != nil {
-			nodeName := blueNode.GetSymbol().name
-			nodeType := blueNode.GetSymbol().GetType()
-			if nodeType == nodeType&(PGPARM|PPINT|PPAINT|PPREAL|PPAREAL) {
-				list.AddOffset(nodeName, "FFFFFFFF")
-			} else {
-				list.AddOffset(nodeName, strconv.Itoa(runningTotal))
-				runningTotal += blueNode.size
-			}
-		}
-	}
+func (node *GreenNode) GetName() string {
+	return node.name
+}
 
-	for _, greenNode := range node.children {
-		greenNode.GetMemoryOffset(list)
+// Path returns the names of the scopes enclosing node, starting with
+// the program or unit, separated by slashes.
+func (node *GreenNode) Path() string {
+	if node.parent == nil || node.sym == nil || node.sym.kind != ProcedureSym {
+		return node.name
 	}
+	return node.parent.Path() + "/" + node.name
 }
 
-func (node *GreenNode) GetName() string {
-	return node.name
+func (node *GreenNode) GetSymbol() *Symbol {
+	return node.sym
 }
 
 func (node *GreenNode) AddChild(newNode *GreenNode) {
 	node.children = append(node.children, newNode)
+	if _, ok := node.procs[newNode.name]; !ok {
+		node.procs[newNode.name] = newNode
+	}
+	if newNode.sym != nil {
+		newNode.sym.scope = node
+	}
 }
 
 func (node *GreenNode) RemoveChild(removeNode *GreenNode) {
@@ -95,6 +106,9 @@ func (node *GreenNode) RemoveChild(removeNode *GreenNode) {
 
 		if match != -1 {
 			node.children = append(node.children[:match], node.children[match+1:]...)
+			if node.procs[removeNode.name] == removeNode {
+				delete(node.procs, removeNode.name)
+			}
 		}
 	}
 }
@@ -107,60 +121,157 @@ func (scope *ScopeTree) AddGreenNode(name string, sym *Symbol) {
 	newGreenNode.parent = currentNode
 }
 
-func (node *GreenNode) FindGreenNode(name string) *GreenNode {
-	for _, greenNode := range node.children {
-		if greenNode.name == name {
-			return greenNode
+// Lookup finds the innermost declaration of name visible from this
+// scope. Variables, types, constants and procedures share one namespace,
+// so each scope is searched for a name of any kind before its enclosing
+// scope. The result is a BlueNode for a procedure's parameters and
+// locals, or a GreenNode for a procedure; both are nil when name is not
+// declared. A procedure can see itself, so recursive calls resolve to
+// node.
+func (node *GreenNode) Lookup(name string) (*BlueNode, *GreenNode) {
+	for scope := node; scope != nil; scope = scope.parent {
+		if blueNode, ok := scope.symbols[name]; ok {
+			return blueNode, nil
+		}
+		if greenNode, ok := scope.procs[name]; ok {
+			return nil, greenNode
+		}
+		if scope.name == name && scope.IsProcedure() {
+			return nil, scope
 		}
 	}
+	return nil, nil
+}
+
+// FindGreenNode looks for a procedure visible from this scope. It
+// returns nil when the innermost declaration of name is not a
+// procedure.
+func (node *GreenNode) FindGreenNode(name string) *GreenNode {
+	_, greenNode := node.Lookup(name)
+	return greenNode
+}
 
-	if node.parent != nil {
-		if node.parent.name == name {
-			return node.parent
-		} else {
-			return node.parent.FindGreenNode(name)
+// Import makes the symbols of a unit visible from the root scope. The
+// most recently imported unit is searched first. A copy of the unit's
+// node is linked in so that the same unit can be imported by several
+// trees.
+func (scope *ScopeTree) Import(node *GreenNode) {
+	imported := *node
+	imported.parent = scope.root.parent
+	scope.root.parent = &imported
+}
+
+// IsImported reports whether a unit called name has been imported.
+func (scope *ScopeTree) IsImported(name string) bool {
+	for node := scope.root.parent; node != nil; node = node.parent {
+		if node.name == name {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
-func (node *GreenNode) AddBlueNode(name string, sym *Symbol, size int) error {
-	newBlueNode := NewBlueNode(name, sym, size)
+// Reopen pushes a procedure that was declared forward back onto the
+// stack so that its full declaration is parsed in its own scope.
+func (scope *ScopeTree) Reopen(node *GreenNode) {
+	scope.stack.Push(node)
+}
+
+func (node *GreenNode) GetParent() *GreenNode {
+	return node.parent
+}
+
+func (node *GreenNode) GetChildren() []*GreenNode {
+	return node.children
+}
+
+func (node *GreenNode) IsForward() bool {
+	return node.forward
+}
 
-	blueNode, _ := node.FindBlueNode(name)
-	if blueNode != nil {
-		blueNodeSym := blueNode.sym
-		nodeType := blueNodeSym.GetType()
+func (node *GreenNode) SetForward(forward bool) {
+	node.forward = forward
+}
+
+// ClearParams removes the parameters of a procedure and gives it an
+// empty signature. The old parameters and signature are returned so
+// that they can be compared with a redeclaration or put back with
+// RestoreParams.
+func (node *GreenNode) ClearParams() ([]*BlueNode, types.Type) {
+	vars := node.vars
+	typeName := node.sym.GetType()
+
+	node.vars = make([]*BlueNode, 0)
+	node.symbols = make(map[string]*BlueNode)
+	node.params = 0
+	node.sym.SetType(types.NewProcedure())
+
+	return vars, typeName
+}
 
-		if nodeType == sym.GetType() {
-			return fmt.Errorf("Variable already exists with same type")
+func (node *GreenNode) RestoreParams(vars []*BlueNode, typeName types.Type) {
+	node.vars = vars
+	node.symbols = make(map[string]*BlueNode)
+	for _, blueNode := range vars {
+		if _, ok := node.symbols[blueNode.name]; !ok {
+			node.symbols[blueNode.name] = blueNode
 		}
 	}
+	node.params = len(vars)
+	node.sym.SetType(typeName)
+}
+
+// AddBlueNode declares name in this scope. It fails when name is
+// already declared in this scope, whatever it was declared as; a name
+// declared in an enclosing scope is shadowed.
+func (node *GreenNode) AddBlueNode(name string, sym *Symbol, size int) error {
+	if node.Declared(name) != nil {
+		return fmt.Errorf("%s already declared", name)
+	}
 
+	newBlueNode := NewBlueNode(name, sym, size)
 	node.vars = append(node.vars, newBlueNode)
+	node.symbols[name] = newBlueNode
+	sym.scope = node
 
 	return nil
 }
 
-func (node *GreenNode) FindBlueNode(name string) (*BlueNode, error) {
-	for _, blueNode := range node.vars {
-		if blueNode != nil {
-			if blueNode.name == name {
-				return blueNode, nil
-			}
-		}
+// Declared returns the symbol name is declared as in this scope, either
+// a variable, parameter, type or constant or a procedure, or nil when it
+// is not declared here.
+func (node *GreenNode) Declared(name string) *Symbol {
+	if blueNode, ok := node.symbols[name]; ok {
+		return blueNode.sym
 	}
-
-	if node.parent != nil {
-		blueNode, _ := node.parent.FindBlueNode(name)
-		if blueNode != nil {
-			return blueNode, nil
-		}
+	if greenNode, ok := node.procs[name]; ok {
+		return greenNode.sym
 	}
+	return nil
+}
 
+// FindBlueNode looks for a variable, parameter, type or constant
+// visible from this scope. It fails when the innermost declaration of
+// name is a procedure.
+func (node *GreenNode) FindBlueNode(name string) (*BlueNode, error) {
+	if blueNode, _ := node.Lookup(name); blueNode != nil {
+		return blueNode, nil
+	}
 	return nil, fmt.Errorf("Variable not found")
 }
 
+// FindLocalBlueNode looks for name in this scope only, without
+// searching the enclosing scopes.
+func (node *GreenNode) FindLocalBlueNode(name string) *BlueNode {
+	return node.symbols[name]
+}
+
+// FindLocalGreenNode looks for a procedure declared directly in this
+// scope.
+func (node *GreenNode) FindLocalGreenNode(name string) *GreenNode {
+	return node.procs[name]
+}
+
 func (node *GreenNode) GetVars() []*BlueNode {
 	return node.vars
 }
@@ -169,26 +280,23 @@ func (node *GreenNode) IncParam() {
 	node.params++
 }
 
-func (node *GreenNode) GetNumParams() int {
-	return node.params
+// AddParam appends a formal parameter to the procedure's signature.
+func (node *GreenNode) AddParam(name string, typeName types.Type) {
+	if proc, ok := node.sym.GetType().(*types.Procedure); ok {
+		proc.AddParam(name, typeName)
+	}
+	node.IncParam()
 }
 
-func (node *GreenNode) Print() {
-	fmt.Println(node.name)
-	for _, blueNode := range node.vars {
-		if blueNode != nil {
-			fmt.Print("\t")
-			fmt.Print(blueNode)
-			fmt.Print("\n")
-		}
+func (node *GreenNode) GetParams() []*types.Param {
+	if proc, ok := node.sym.GetType().(*types.Procedure); ok {
+		return proc.Params
 	}
+	return nil
+}
 
-	for _, greenNode := range node.children {
-		if greenNode != nil {
-			greenNode.Print()
-		}
-	}
-	fmt.Println()
+func (node *GreenNode) GetNumParams() int {
+	return node.params
 }
 
 func (node *BlueNode) GetSymbol() *Symbol {
@@ -1,57 +1,88 @@
 package util
 
 import _ "container/list"
+import "bytes"
 import "fmt"
-import "errors"
 import "os"
+import "text/tabwriter"
+import "compiler/types"
 
+// SymbolTable lists every symbol of a compilation in declaration order.
+// Names are looked up through the scope each symbol belongs to, not
+// through the table.
 type SymbolTable struct {
 	list []*Symbol
 }
 
+// Symbol is a declared name. scope is the scope the name was declared
+// in; it is nil for the program or unit itself. reads and writes are the
+// lines the name is used on.
 type Symbol struct {
 	name     string
-	typeName AttributeType
+	kind     SymbolKind
+	typeName types.Type
 	size     int
-	value    *interface{}
+	line     int
+	value    interface{}
+	scope    *GreenNode
+	reads    []int
+	writes   []int
+}
+
+// SymbolKind records what a name was declared as. Parameters are
+// distinguished from locals by their kind rather than their type.
+type SymbolKind uint
+
+const (
+	ProgramSym SymbolKind = iota
+	ProgramParamSym
+	ProcedureSym
+	VariableSym
+	ParameterSym
+	TypeSym
+	ConstantSym
+	UnitSym
+)
+
+var KindStrings map[SymbolKind]string = map[SymbolKind]string{
+	ProgramSym:      "program",
+	ProgramParamSym: "program parameter",
+	ProcedureSym:    "procedure",
+	VariableSym:     "variable",
+	ParameterSym:    "parameter",
+	TypeSym:         "type",
+	ConstantSym:     "constant",
+	UnitSym:         "unit",
 }
 
 func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{make([]*Symbol, 0)}
 }
 
-func NewSymbol(name string, typeName AttributeType) *Symbol {
-	return &Symbol{name: name, typeName: typeName}
+func NewSymbol(name string, kind SymbolKind, typeName types.Type) *Symbol {
+	return &Symbol{name: name, kind: kind, typeName: typeName}
 }
 
 // SYMBOL TABLE
 
-func (st *SymbolTable) GetPtr(name string, typeAttr AttributeType) (*Symbol, error) {
-	for _, symbol := range st.list {
-		if symbol == nil {
-			return &Symbol{}, errors.New("Symbol not found.")
-		} else if name == symbol.name && symbol.GetType() == typeAttr {
-			return symbol, nil
-		}
-	}
-
-	return &Symbol{}, errors.New("Error")
+// AddSymbol records a symbol for the symbol file. Checking for
+// duplicate declarations is up to the scope the symbol is added to.
+func (st *SymbolTable) AddSymbol(sym *Symbol) {
+	st.list = append(st.list, sym)
 }
 
-func (st *SymbolTable) AddSymbol(sym *Symbol) error {
-	name := sym.name
-	symType := sym.GetType()
-	_, err := st.GetPtr(name, symType)
-
-	if err != nil {
-		st.list = append(st.list, sym)
-		return nil
-	} else {
-		return fmt.Errorf("Variable already declared")
+// RemoveSymbol takes sym out of the table, for a declaration that has
+// been replaced by another.
+func (st *SymbolTable) RemoveSymbol(sym *Symbol) {
+	for i, symbol := range st.list {
+		if symbol == sym {
+			st.list = append(st.list[:i], st.list[i+1:]...)
+			return
+		}
 	}
 }
 
-// func (st *SymbolTable) AssignType(id string, typeName AttributeType) {
+// func (st *SymbolTable) AssignType(id string, typeName types.Type) {
 // 	sym, err := st.GetPtr(id, typeName)
 // 	if err != nil {
 // 		fmt.Errorf("Error getting %s from symbol table", id)
@@ -69,17 +100,30 @@ func (st *SymbolTable) Print() {
 	fmt.Println()
 }
 
+// String formats the table with one symbol per line, giving the scope
+// it was declared in, its kind, its type and the line it was declared
+// on.
 func (st *SymbolTable) String() string {
-	var st_string string
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SCOPE\tNAME\tKIND\tTYPE\tLINE")
 	for _, symbol := range st.list {
-		if symbol == nil {
-			break
+		scope := "-"
+		if symbol.scope != nil {
+			scope = symbol.scope.Path()
+		}
+
+		typeName := "-"
+		if symbol.typeName != nil {
+			typeName = symbol.typeName.String()
 		}
 
-		st_string += symbol.String()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", scope, symbol.name, symbol.kind, typeName, symbol.line)
 	}
-	st_string += "\n"
-	return st_string
+
+	w.Flush()
+	return buf.String()
 }
 
 func (st *SymbolTable) Write() string {
@@ -96,14 +140,78 @@ func (st *SymbolTable) Write() string {
 
 // SYMBOL
 
-func (sym *Symbol) GetType() AttributeType {
+func (sym *Symbol) GetName() string {
+	return sym.name
+}
+
+func (sym *Symbol) GetKind() SymbolKind {
+	return sym.kind
+}
+
+func (sym *Symbol) GetType() types.Type {
 	return sym.typeName
 }
 
-func (sym *Symbol) SetType(typeName AttributeType) {
+func (sym *Symbol) SetType(typeName types.Type) {
 	sym.typeName = typeName
 }
 
+// GetValue returns the value of a constant, such as the ordinal of an
+// enumerator.
+func (sym *Symbol) GetValue() interface{} {
+	return sym.value
+}
+
+func (sym *Symbol) SetValue(value interface{}) {
+	sym.value = value
+}
+
+// GetScope returns the scope the symbol was declared in.
+func (sym *Symbol) GetScope() *GreenNode {
+	return sym.scope
+}
+
+// GetLine returns the source line the symbol was declared on.
+func (sym *Symbol) GetLine() int {
+	return sym.line
+}
+
+func (sym *Symbol) SetLine(line int) {
+	sym.line = line
+}
+
+// AddRead records that the symbol is used on line without being
+// assigned to. A type, constant or procedure is only ever read.
+func (sym *Symbol) AddRead(line int) {
+	sym.reads = append(sym.reads, line)
+}
+
+// AddWrite records that the variable is assigned to on line.
+func (sym *Symbol) AddWrite(line int) {
+	sym.writes = append(sym.writes, line)
+}
+
+// ReadToWrite turns the last read recorded on line into a write. It is
+// used for a variable parsed as an expression that turns out to be
+// assigned to.
+func (sym *Symbol) ReadToWrite(line int) {
+	for i := len(sym.reads) - 1; i >= 0; i-- {
+		if sym.reads[i] == line {
+			sym.reads = append(sym.reads[:i], sym.reads[i+1:]...)
+			break
+		}
+	}
+	sym.AddWrite(line)
+}
+
+func (sym *Symbol) GetReads() []int {
+	return sym.reads
+}
+
+func (sym *Symbol) GetWrites() []int {
+	return sym.writes
+}
+
 func (sym *Symbol) GetSize() int {
 	return sym.size
 }
@@ -113,6 +221,33 @@ func (sym *Symbol) SetSize(newSize int) {
 }
 
 func (sym *Symbol) String() string {
-	return fmt.Sprintln(sym.name, sym.typeName, sym.value)
+	if sym.typeName == nil {
+		return fmt.Sprintln(sym.name, sym.kind)
+	}
+	return fmt.Sprintln(sym.name, sym.kind, sym.typeName)
 	// return sym.name
 }
+
+func (kind SymbolKind) String() string {
+	return KindStrings[kind]
+}
+
+// MarshalText stores a kind by name, so that files holding symbols do
+// not depend on the order of the kinds.
+func (kind SymbolKind) MarshalText() ([]byte, error) {
+	str, ok := KindStrings[kind]
+	if !ok {
+		return nil, fmt.Errorf("Unknown symbol kind %d", kind)
+	}
+	return []byte(str), nil
+}
+
+func (kind *SymbolKind) UnmarshalText(text []byte) error {
+	for k, str := range KindStrings {
+		if str == string(text) {
+			*kind = k
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown symbol kind %s", text)
+}
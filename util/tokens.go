@@ -42,9 +42,8 @@ const (
 	SUB
 	MUL
 	DIV
+	REAL_DIV
 	PROG
-	PGNAME
-	PGPARM
 	VAR
 	OF
 	INT_DEC
@@ -55,13 +54,6 @@ const (
 	LONG_REAL
 	REAL
 	INT
-	BOOL
-	AINT
-	AREAL
-	PPINT
-	PPAINT
-	PPREAL
-	PPAREAL
 	IF
 	THEN
 	ELSE
@@ -81,7 +73,22 @@ const (
 	COLON
 	END
 	CALL
-	ERR
+	RECORD
+	FOR
+	TO
+	DOWNTO
+	REPEAT
+	UNTIL
+	CASE
+	TYPE
+	NIL
+	CARET
+	SET
+	IN
+	UNIT
+	USES
+	INTERFACE
+	IMPLEMENTATION
 	ERR_STAR
 	NEWLINE
 )
@@ -115,9 +122,8 @@ var AttrStrings map[AttributeType]string = map[AttributeType]string{
 	SUB:             "SUB",
 	MUL:             "MUL",
 	DIV:             "DIV",
+	REAL_DIV:        "REAL_DIV",
 	PROG:            "PROG",
-	PGNAME:          "PGNAME",
-	PGPARM:          "PGPARM",
 	VAR:             "VAR",
 	OF:              "OF",
 	INT_DEC:         "INT_DEC",
@@ -128,13 +134,6 @@ var AttrStrings map[AttributeType]string = map[AttributeType]string{
 	LONG_REAL:       "LONG_REAL",
 	REAL:            "REAL",
 	INT:             "INT",
-	BOOL:            "BOOL",
-	AINT:            "AINT",
-	AREAL:           "AREAL",
-	PPINT:           "PPINT",
-	PPAINT:          "PPAINT",
-	PPREAL:          "PPREAL",
-	PPAREAL:         "PPAREAL",
 	IF:              "IF",
 	THEN:            "THEN",
 	ELSE:            "ELSE",
@@ -154,7 +153,22 @@ var AttrStrings map[AttributeType]string = map[AttributeType]string{
 	COLON:           "COLON",
 	END:             "END",
 	CALL:            "CALL",
-	ERR:             "ERR",
+	RECORD:          "RECORD",
+	FOR:             "FOR",
+	TO:              "TO",
+	DOWNTO:          "DOWNTO",
+	REPEAT:          "REPEAT",
+	UNTIL:           "UNTIL",
+	CASE:            "CASE",
+	TYPE:            "TYPE",
+	NIL:             "NIL",
+	CARET:           "CARET",
+	SET:             "SET",
+	IN:              "IN",
+	UNIT:            "UNIT",
+	USES:            "USES",
+	INTERFACE:       "INTERFACE",
+	IMPLEMENTATION:  "IMPLEMENTATION",
 	ERR_STAR:        "ERR_STAR",
 	NEWLINE:         "NEWLINE",
 }
@@ -0,0 +1,357 @@
+package util
+
+import (
+	"bytes"
+	"compiler/types"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// UnitFile is the persisted form of the symbols a unit exports from its
+// interface section. Programs that use the unit are checked against it
+// without parsing the unit's source again. Interface is a hash of the
+// interface section the file was built from.
+type UnitFile struct {
+	Name      string
+	Interface string
+	Uses      []string
+	Types     []*typeEntry
+	Symbols   []*symbolEntry
+}
+
+// typeEntry is one type in a unit file. Types refer to each other by
+// their index in UnitFile.Types, which lets recursive types through
+// pointers be stored. A type declared by another unit is stored as a
+// reference to that unit and the type's name.
+type typeEntry struct {
+	Kind   string
+	Name   string         `json:",omitempty"`
+	Unit   string         `json:",omitempty"`
+	Low    int            `json:",omitempty"`
+	High   int            `json:",omitempty"`
+	Index  int            `json:",omitempty"`
+	Elem   int            `json:",omitempty"`
+	Names  []string       `json:",omitempty"`
+	Fields []*memberEntry `json:",omitempty"`
+}
+
+// memberEntry is a record field or procedure parameter.
+type memberEntry struct {
+	Name string
+	Type int
+}
+
+type symbolEntry struct {
+	Name  string
+	Kind  SymbolKind
+	Type  int
+	Line  int
+	Value int `json:",omitempty"`
+}
+
+// noType marks a missing type, such as the elements of the empty set.
+const noType = -1
+
+var basicTypes map[string]types.Type = map[string]types.Type{
+	types.Integer.String(): types.Integer,
+	types.Real.String():    types.Real,
+	types.Boolean.String(): types.Boolean,
+}
+
+// NewUnitFile records the first vars symbols and procs procedures
+// declared in node, which are the ones declared in the unit's interface.
+// Types declared by the units in imports are stored as references.
+func NewUnitFile(node *GreenNode, vars int, procs int, uses []string, imports map[string]*GreenNode) *UnitFile {
+	uf := &UnitFile{Name: node.name, Uses: uses}
+	enc := &typeEncoder{uf, make(map[types.Type]int), make(map[types.Type]*typeEntry)}
+
+	for _, name := range uses {
+		if unit := imports[name]; unit != nil {
+			for _, blueNode := range unit.vars {
+				if blueNode.sym.kind == TypeSym {
+					enc.refs[blueNode.sym.typeName] = &typeEntry{Kind: "ref", Name: blueNode.name, Unit: name}
+				}
+			}
+		}
+	}
+
+	for _, blueNode := range node.vars[:vars] {
+		sym := blueNode.sym
+		entry := &symbolEntry{sym.name, sym.kind, enc.encode(sym.typeName), sym.line, 0}
+		if value, ok := sym.value.(int); ok {
+			entry.Value = value
+		}
+		uf.Symbols = append(uf.Symbols, entry)
+	}
+
+	for _, greenNode := range node.children[:procs] {
+		sym := greenNode.sym
+		uf.Symbols = append(uf.Symbols, &symbolEntry{sym.name, sym.kind, enc.encode(sym.typeName), sym.line, 0})
+	}
+
+	return uf
+}
+
+// LoadUnitFile reads a unit file written by Save.
+func LoadUnitFile(file string) (*UnitFile, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	uf := new(UnitFile)
+	if err := json.Unmarshal(data, uf); err != nil {
+		return nil, err
+	}
+	return uf, nil
+}
+
+// Save writes the unit file. A file whose contents have not changed is
+// left alone.
+func (uf *UnitFile) Save(file string) error {
+	data, err := json.MarshalIndent(uf, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	old, err := ioutil.ReadFile(file)
+	if err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// Scope rebuilds the unit's exported symbols as a scope that can be
+// imported into a ScopeTree. References to types of other units are
+// looked up in imports. It fails when a type cannot be rebuilt, such as
+// a type another unit no longer declares.
+func (uf *UnitFile) Scope(imports map[string]*GreenNode) (*GreenNode, error) {
+	decoded, err := uf.decodeTypes(imports)
+	if err != nil {
+		return nil, err
+	}
+	typeOf := func(idx int) types.Type {
+		if idx == noType {
+			return types.Invalid
+		}
+		return decoded[idx]
+	}
+	for _, entry := range uf.Symbols {
+		if entry.Type != noType && (entry.Type < 0 || entry.Type >= len(decoded)) {
+			return nil, fmt.Errorf("Unit file of %s is damaged: symbol %s has no type", uf.Name, entry.Name)
+		}
+	}
+
+	node := NewGreenNode(uf.Name, NewSymbol(uf.Name, UnitSym, nil))
+
+	for _, entry := range uf.Symbols {
+		sym := NewSymbol(entry.Name, entry.Kind, typeOf(entry.Type))
+		sym.SetLine(entry.Line)
+
+		switch entry.Kind {
+		case ProcedureSym:
+			proc := NewGreenNode(entry.Name, sym)
+			proc.parent = node
+			node.AddChild(proc)
+
+			for _, param := range proc.GetParams() {
+				proc.AddBlueNode(param.Name, NewSymbol(param.Name, ParameterSym, param.Type), param.Type.Size())
+				proc.IncParam()
+			}
+		case ConstantSym:
+			sym.SetValue(entry.Value)
+			node.AddBlueNode(entry.Name, sym, 0)
+		case VariableSym:
+			node.AddBlueNode(entry.Name, sym, sym.GetType().Size())
+		default:
+			node.AddBlueNode(entry.Name, sym, 0)
+		}
+	}
+
+	return node, nil
+}
+
+type typeEncoder struct {
+	uf      *UnitFile
+	indices map[types.Type]int
+	refs    map[types.Type]*typeEntry
+}
+
+// encode adds t to the type table and returns its index. The index is
+// reserved before the parts of t are encoded so that a record can point
+// to itself.
+func (enc *typeEncoder) encode(t types.Type) int {
+	if t == nil || t == types.EmptySet {
+		return noType
+	}
+
+	if idx, ok := enc.indices[t]; ok {
+		return idx
+	}
+
+	idx := len(enc.uf.Types)
+	enc.indices[t] = idx
+
+	if ref, ok := enc.refs[t]; ok {
+		enc.uf.Types = append(enc.uf.Types, ref)
+		return idx
+	}
+
+	entry := &typeEntry{}
+	enc.uf.Types = append(enc.uf.Types, entry)
+
+	switch typ := t.(type) {
+	case *types.Basic:
+		entry.Kind = "basic"
+		entry.Name = typ.String()
+	case *types.Array:
+		entry.Kind = "array"
+		entry.Low, entry.High = typ.Low, typ.High
+		entry.Index = enc.encode(typ.Index)
+		entry.Elem = enc.encode(typ.Elem)
+	case *types.OpenArray:
+		entry.Kind = "openarray"
+		entry.Elem = enc.encode(typ.Elem)
+	case *types.Record:
+		entry.Kind = "record"
+		for _, field := range typ.Fields {
+			entry.Fields = append(entry.Fields, &memberEntry{field.Name, enc.encode(field.Type)})
+		}
+	case *types.Enum:
+		entry.Kind = "enum"
+		entry.Name = typ.Name
+		entry.Names = typ.Names
+	case *types.Subrange:
+		entry.Kind = "subrange"
+		entry.Name = typ.Name
+		entry.Low, entry.High = typ.Low, typ.High
+		entry.Elem = enc.encode(typ.Base)
+	case *types.Pointer:
+		entry.Kind = "pointer"
+		entry.Name = typ.Name
+		entry.Elem = enc.encode(typ.Elem)
+	case *types.Set:
+		entry.Kind = "set"
+		entry.Elem = enc.encode(typ.Elem)
+	case *types.Procedure:
+		entry.Kind = "procedure"
+		for _, param := range typ.Params {
+			entry.Fields = append(entry.Fields, &memberEntry{param.Name, enc.encode(param.Type)})
+		}
+	default:
+		entry.Kind = "basic"
+		entry.Name = types.Invalid.String()
+	}
+
+	return idx
+}
+
+// decodeTypes rebuilds the type table. Every type is allocated first and
+// then filled in, filling in the parts of a type before the type itself
+// so that record sizes and field offsets come out right.
+func (uf *UnitFile) decodeTypes(imports map[string]*GreenNode) ([]types.Type, error) {
+	decoded := make([]types.Type, len(uf.Types))
+	filled := make([]bool, len(uf.Types))
+
+	for i, entry := range uf.Types {
+		switch entry.Kind {
+		case "basic":
+			basic, ok := basicTypes[entry.Name]
+			if !ok {
+				return nil, fmt.Errorf("Unit file of %s is damaged: unknown type %s", uf.Name, entry.Name)
+			}
+			decoded[i] = basic
+		case "ref":
+			unit := imports[entry.Unit]
+			if unit == nil {
+				return nil, fmt.Errorf("Unit %s refers to type %s of unit %s, which is not used", uf.Name, entry.Name, entry.Unit)
+			}
+			blueNode := unit.FindLocalBlueNode(entry.Name)
+			if blueNode == nil || blueNode.sym.kind != TypeSym {
+				return nil, fmt.Errorf("Unit %s refers to type %s of unit %s, which no longer declares it", uf.Name, entry.Name, entry.Unit)
+			}
+			decoded[i] = blueNode.sym.typeName
+		case "array":
+			decoded[i] = &types.Array{Low: entry.Low, High: entry.High}
+		case "openarray":
+			decoded[i] = types.NewOpenArray(nil)
+		case "record":
+			decoded[i] = types.NewRecord()
+		case "enum":
+			decoded[i] = &types.Enum{Name: entry.Name, Names: entry.Names}
+		case "subrange":
+			decoded[i] = &types.Subrange{Name: entry.Name, Low: entry.Low, High: entry.High}
+		case "pointer":
+			decoded[i] = types.NewPointer(entry.Name, nil)
+		case "set":
+			decoded[i] = types.NewSet(nil)
+		case "procedure":
+			decoded[i] = types.NewProcedure()
+		default:
+			return nil, fmt.Errorf("Unit file of %s is damaged: unknown kind of type %s", uf.Name, entry.Kind)
+		}
+	}
+
+	// Every reference between entries must name an entry of the table.
+	valid := func(idx int) bool {
+		return idx == noType || idx >= 0 && idx < len(decoded)
+	}
+	for _, entry := range uf.Types {
+		refs := []int{entry.Index, entry.Elem}
+		for _, member := range entry.Fields {
+			refs = append(refs, member.Type)
+		}
+		for _, idx := range refs {
+			if !valid(idx) {
+				return nil, fmt.Errorf("Unit file of %s is damaged: type %d does not exist", uf.Name, idx)
+			}
+		}
+	}
+
+	typeOf := func(idx int) types.Type {
+		if idx == noType {
+			return nil
+		}
+		return decoded[idx]
+	}
+
+	var fill func(i int)
+	fill = func(i int) {
+		if i < 0 || i >= len(decoded) || filled[i] {
+			return
+		}
+		filled[i] = true
+
+		entry := uf.Types[i]
+		switch typ := decoded[i].(type) {
+		case *types.Array:
+			fill(entry.Elem)
+			typ.Index, typ.Elem = typeOf(entry.Index), typeOf(entry.Elem)
+		case *types.OpenArray:
+			typ.Elem = typeOf(entry.Elem)
+		case *types.Record:
+			for _, field := range entry.Fields {
+				fill(field.Type)
+				typ.AddField(field.Name, typeOf(field.Type))
+			}
+		case *types.Subrange:
+			typ.Base = typeOf(entry.Elem)
+		case *types.Pointer:
+			typ.Elem = typeOf(entry.Elem)
+		case *types.Set:
+			typ.Elem = typeOf(entry.Elem)
+		case *types.Procedure:
+			for _, param := range entry.Fields {
+				typ.AddParam(param.Name, typeOf(param.Type))
+			}
+		}
+	}
+
+	for i := range decoded {
+		fill(i)
+	}
+
+	return decoded, nil
+}
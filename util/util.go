@@ -6,6 +6,7 @@ import (
 	_ "fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -40,6 +41,15 @@ func GenerateTimeString(t time.Time) string {
 	return underscoreTime
 }
 
+// LineList formats a list of source lines as "3, 8, 12".
+func LineList(lines []int) string {
+	strs := make([]string, len(lines))
+	for i, line := range lines {
+		strs[i] = strconv.Itoa(line)
+	}
+	return strings.Join(strs, ", ")
+}
+
 func ReadFile(file string) *Buffer {
 	openFile, err := os.Open(file)
 	if err != nil {
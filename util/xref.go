@@ -0,0 +1,77 @@
+package util
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "io/ioutil"
+import "sort"
+import "text/tabwriter"
+
+// XRefEntry is the cross-reference of one symbol: where it is declared
+// and the lines it is read and written on.
+type XRefEntry struct {
+	Name   string
+	Scope  string
+	Kind   string
+	Type   string
+	Line   int
+	Reads  []int
+	Writes []int
+}
+
+// CrossReference builds the cross-reference of every symbol in the
+// table, sorted by name and then by scope.
+func (st *SymbolTable) CrossReference() []*XRefEntry {
+	entries := make([]*XRefEntry, 0, len(st.list))
+	for _, sym := range st.list {
+		entry := &XRefEntry{
+			Name:   sym.name,
+			Kind:   sym.kind.String(),
+			Line:   sym.line,
+			Reads:  append([]int{}, sym.reads...),
+			Writes: append([]int{}, sym.writes...),
+		}
+		if sym.scope != nil {
+			entry.Scope = sym.scope.Path()
+		}
+		if sym.typeName != nil {
+			entry.Type = sym.typeName.String()
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Scope < entries[j].Scope
+	})
+	return entries
+}
+
+// WriteCrossReference writes the cross-reference as text to xref.txt
+// and as JSON to xref.json.
+func (st *SymbolTable) WriteCrossReference() {
+	entries := st.CrossReference()
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCOPE\tKIND\tTYPE\tDECLARED\tREAD\tWRITTEN")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", entry.Name, orDash(entry.Scope), entry.Kind, orDash(entry.Type), entry.Line, orDash(LineList(entry.Reads)), orDash(LineList(entry.Writes)))
+	}
+	w.Flush()
+	ioutil.WriteFile("xref.txt", buf.Bytes(), 0644)
+
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err == nil {
+		ioutil.WriteFile("xref.json", data, 0644)
+	}
+}
+
+func orDash(str string) string {
+	if str == "" {
+		return "-"
+	}
+	return str
+}